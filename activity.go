@@ -0,0 +1,315 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// --- Session activity ---
+func runActivity(db *sql.DB, args []string, f outputFormat) {
+	args, sinceStr, hasSince := popValue(args, "--since")
+	if _, summary := popFlag(args, "--summary-only"); summary {
+		showActivitySummary(db)
+		return
+	}
+
+	var since time.Duration
+	if hasSince {
+		d, err := time.ParseDuration(sinceStr)
+		if err != nil || d <= 0 {
+			fmt.Fprintln(stdout, "{⚠️  } --since expects a positive duration like 30s or 5m")
+			exit(1)
+		}
+		since = d
+	}
+	showActivity(db, since, f)
+}
+
+func runLocks(db *sql.DB, args []string) {
+	if _, summary := popFlag(args, "--summary-only"); summary {
+		showActivitySummary(db)
+		return
+	}
+	showBlockingLocks(db)
+}
+
+// showBlockingLocks lists each blocked backend next to the backend holding
+// it up, using pg_blocking_pids to walk the lock graph.
+func showBlockingLocks(db *sql.DB) {
+	rows, err := db.Query(`
+		SELECT blocked.pid,
+		       coalesce(blocked.usename, ''),
+		       coalesce(string_agg(DISTINCT l.relation::regclass::text, ', '), '-'),
+		       extract(epoch FROM now() - blocked.query_start),
+		       coalesce(blocked.query, ''),
+		       blocking.pid,
+		       coalesce(blocking.usename, ''),
+		       coalesce(blocking.state, 'unknown'),
+		       coalesce(blocking.query, '')
+		FROM pg_stat_activity blocked
+		JOIN LATERAL unnest(pg_blocking_pids(blocked.pid)) AS b(pid) ON true
+		JOIN pg_stat_activity blocking ON blocking.pid = b.pid
+		LEFT JOIN pg_locks l ON l.pid = blocked.pid AND NOT l.granted AND l.relation IS NOT NULL
+		GROUP BY blocked.pid, blocked.usename, blocked.query_start, blocked.query,
+		         blocking.pid, blocking.usename, blocking.state, blocking.query
+		ORDER BY blocked.query_start, blocked.pid, blocking.pid;
+	`)
+	if err != nil {
+		fmt.Fprintf(stdout, "{⚠️  } Failed to read locks: %v\n", err)
+		exit(1)
+	}
+	defer rows.Close()
+
+	var data [][]string
+	for rows.Next() {
+		var blockedPid, blockingPid int
+		var blockedUser, relations, blockedQuery, blockingUser, blockingState, blockingQuery string
+		var waited sql.NullFloat64
+		if err := rows.Scan(&blockedPid, &blockedUser, &relations, &waited, &blockedQuery,
+			&blockingPid, &blockingUser, &blockingState, &blockingQuery); err != nil {
+			fmt.Fprintf(stdout, "{⚠️  } Failed to read lock: %v\n", err)
+			continue
+		}
+
+		wait := "-"
+		if waited.Valid {
+			wait = time.Duration(waited.Float64 * float64(time.Second)).Round(time.Second).String()
+		}
+		data = append(data, []string{
+			strconv.Itoa(blockedPid), blockedUser, relations, wait, blockedQuery,
+			strconv.Itoa(blockingPid), blockingUser, blockingState, blockingQuery,
+		})
+	}
+
+	if len(data) == 0 {
+		fmt.Fprintln(stdout, "{✅ } No blocking locks detected")
+		exitIfEmpty()
+		return
+	}
+
+	renderTable([]string{"blocked", "user", "relation", "waiting", "query", "blocking", "user", "state", "query"}, data)
+	fmt.Fprintf(output, "(%d blocked pair(s))\n", len(data))
+}
+
+// showActivity lists non-idle sessions other than our own, oldest query
+// first, so runaway queries surface at the top. A non-zero since keeps only
+// queries that have been running longer than that.
+func showActivity(db *sql.DB, since time.Duration, f outputFormat) {
+	rows, err := db.Query(`
+		SELECT pid, coalesce(usename, ''), coalesce(application_name, ''), coalesce(state, 'unknown'), query_start,
+		       extract(epoch FROM now() - query_start), coalesce(query, '')
+		FROM pg_stat_activity
+		WHERE state IS DISTINCT FROM 'idle'
+		  AND backend_type = 'client backend'
+		  AND pid <> pg_backend_pid()
+		  AND ($1::float8 = 0 OR now() - query_start > make_interval(secs => $1::float8))
+		ORDER BY query_start ASC NULLS LAST;
+	`, since.Seconds())
+	if err != nil {
+		fmt.Fprintf(stdout, "{⚠️  } Failed to read activity: %v\n", err)
+		exit(1)
+	}
+	defer rows.Close()
+
+	var data [][]string
+	for rows.Next() {
+		var pid int
+		var user, app, state, query string
+		var started sql.NullTime
+		var age sql.NullFloat64
+		if err := rows.Scan(&pid, &user, &app, &state, &started, &age, &query); err != nil {
+			fmt.Fprintf(stdout, "{⚠️  } Failed to read session: %v\n", err)
+			continue
+		}
+
+		start := "-"
+		if started.Valid {
+			start = formatValue(started.Time)
+			if age.Valid {
+				start += fmt.Sprintf(" (%s)", time.Duration(age.Float64*float64(time.Second)).Round(time.Second))
+			}
+		}
+		data = append(data, []string{strconv.Itoa(pid), user, app, state, start, query})
+	}
+
+	headers := []string{"pid", "user", "application", "state", "query_start", "query"}
+	if f != formatTable {
+		emitRows(f, headers, data)
+		if len(data) == 0 {
+			exitIfEmpty()
+		}
+		return
+	}
+
+	if len(data) == 0 {
+		if since > 0 {
+			fmt.Fprintf(stdout, "{💤 } No sessions running longer than %s\n", since)
+		} else {
+			fmt.Fprintln(stdout, "{💤 } No active sessions besides this one")
+		}
+		exitIfEmpty()
+		return
+	}
+
+	renderTable(headers, data)
+	fmt.Fprintf(output, "(%d session(s))\n", len(data))
+}
+
+// showActivitySummary prints aggregate session counts as a quick health
+// pulse before drilling into per-session detail.
+func showActivitySummary(db *sql.DB) {
+	rows, err := db.Query(`
+		SELECT coalesce(state, 'unknown'), count(*)
+		FROM pg_stat_activity
+		WHERE backend_type = 'client backend'
+		GROUP BY 1
+		ORDER BY 2 DESC, 1;
+	`)
+	if err != nil {
+		fmt.Fprintf(stdout, "{⚠️  } Failed to read session states: %v\n", err)
+		exit(1)
+	}
+	defer rows.Close()
+
+	fmt.Fprintln(output, "{📊 } Sessions by state:")
+	for rows.Next() {
+		var state string
+		var n int
+		if err := rows.Scan(&state, &n); err != nil {
+			fmt.Fprintf(stdout, "{⚠️  } Failed to read session state: %v\n", err)
+			exit(1)
+		}
+		fmt.Fprintf(output, "    %-30s %d\n", state, n)
+	}
+	if err := rows.Err(); err != nil {
+		fmt.Fprintf(stdout, "{⚠️  } Failed to read session states: %v\n", err)
+		exit(1)
+	}
+
+	var waiting, blocked int
+	var longest sql.NullFloat64
+	err = db.QueryRow(`
+		SELECT
+			count(*) FILTER (WHERE wait_event_type = 'Lock'),
+			count(*) FILTER (WHERE cardinality(pg_blocking_pids(pid)) > 0),
+			max(extract(epoch FROM now() - query_start)) FILTER (WHERE state = 'active' AND pid <> pg_backend_pid())
+		FROM pg_stat_activity
+		WHERE backend_type = 'client backend';
+	`).Scan(&waiting, &blocked, &longest)
+	if err != nil {
+		fmt.Fprintf(stdout, "{⚠️  } Failed to read wait summary: %v\n", err)
+		exit(1)
+	}
+
+	fmt.Fprintln(output, "")
+	fmt.Fprintf(output, "{⏳ } Waiting on locks:   %d\n", waiting)
+	fmt.Fprintf(output, "{🚧 } Blocked sessions:   %d\n", blocked)
+	if longest.Valid {
+		d := time.Duration(longest.Float64 * float64(time.Second)).Round(time.Second)
+		fmt.Fprintf(output, "{🐢 } Longest query:      %s\n", d)
+	} else {
+		fmt.Fprintln(output, "{🐢 } Longest query:      none running")
+	}
+}
+
+// runSignalBackend cancels the current query of a backend, or terminates the
+// whole session when terminate is set.
+func runSignalBackend(db *sql.DB, args []string, terminate bool) {
+	cmd, fn := "cancel", "pg_cancel_backend"
+	if terminate {
+		cmd, fn = "kill", "pg_terminate_backend"
+	}
+
+	if len(args) != 1 {
+		fmt.Fprintf(stdout, "{⚠️  } Usage: hvmd %s <pid> --core\n", cmd)
+		exit(1)
+	}
+	pid, err := strconv.Atoi(args[0])
+	if err != nil || pid <= 0 {
+		fmt.Fprintf(stdout, "{⚠️  } Not a valid pid: %s\n", args[0])
+		exit(1)
+	}
+
+	// The guard and the signal are one statement so they run on the same
+	// pooled connection; otherwise hvmd could signal one of its own sessions.
+	var own, ok bool
+	err = db.QueryRow(`
+		SELECT $1 = pg_backend_pid(),
+		       CASE WHEN $1 <> pg_backend_pid() THEN `+fn+`($1) ELSE false END;
+	`, pid).Scan(&own, &ok)
+	if err != nil {
+		fmt.Fprintf(stdout, "{⚠️  } %s failed: %v\n", fn, err)
+		exit(1)
+	}
+	if own {
+		fmt.Fprintln(stdout, "{⚠️  } Refusing to signal hvmd's own backend")
+		exit(1)
+	}
+	if !ok {
+		fmt.Fprintf(stdout, "{⚠️  } No backend signalled for pid %d (already gone?)\n", pid)
+		exit(1)
+	}
+
+	if terminate {
+		fmt.Fprintf(stdout, "{✅ } Terminated backend %d\n", pid)
+	} else {
+		fmt.Fprintf(stdout, "{✅ } Cancelled current query of backend %d\n", pid)
+	}
+}
+
+// runKillIdle terminates sessions that have sat idle inside a transaction
+// for longer than --older-than. The flag is required so a bare kill-idle
+// never reaps anything.
+func runKillIdle(db *sql.DB, args []string) {
+	_, olderStr, hasOlder := popValue(args, "--older-than")
+	if !hasOlder {
+		fmt.Fprintln(stdout, "{⚠️  } Usage: hvmd kill-idle --older-than <duration> --core")
+		exit(1)
+	}
+	olderThan, err := time.ParseDuration(olderStr)
+	if err != nil || olderThan <= 0 {
+		fmt.Fprintln(stdout, "{⚠️  } --older-than expects a positive duration like 30s or 10m")
+		exit(1)
+	}
+
+	rows, err := db.Query(`
+		SELECT pid, coalesce(usename, ''), extract(epoch FROM now() - state_change), pg_terminate_backend(pid)
+		FROM pg_stat_activity
+		WHERE state IN ('idle in transaction', 'idle in transaction (aborted)')
+		  AND now() - state_change > make_interval(secs => $1::float8)
+		  AND pid <> pg_backend_pid()
+		ORDER BY state_change;
+	`, olderThan.Seconds())
+	if err != nil {
+		fmt.Fprintf(stdout, "{⚠️  } Failed to terminate idle sessions: %v\n", err)
+		exit(1)
+	}
+	defer rows.Close()
+
+	killed := 0
+	for rows.Next() {
+		var pid int
+		var user string
+		var idle float64
+		var ok bool
+		if err := rows.Scan(&pid, &user, &idle, &ok); err != nil {
+			fmt.Fprintf(stdout, "{⚠️  } Failed to read session: %v\n", err)
+			continue
+		}
+		idleFor := time.Duration(idle * float64(time.Second)).Round(time.Second)
+		if !ok {
+			fmt.Fprintf(stdout, "{⚠️  } Could not terminate backend %d (%s, idle %s)\n", pid, user, idleFor)
+			continue
+		}
+		killed++
+		fmt.Fprintf(output, "    💤  Terminated %d | %s | idle in transaction for %s\n", pid, user, idleFor)
+	}
+
+	if killed == 0 {
+		fmt.Fprintf(stdout, "{✅ } No sessions idle in transaction for longer than %s\n", olderThan)
+		return
+	}
+	fmt.Fprintf(stdout, "{✅ } Terminated %d idle-in-transaction session(s)\n", killed)
+}
@@ -0,0 +1,38 @@
+package main
+
+import "strings"
+
+// popFlag removes every occurrence of a boolean flag from args and reports
+// whether it was present.
+func popFlag(args []string, name string) ([]string, bool) {
+	var rest []string
+	found := false
+	for _, arg := range args {
+		if arg == name {
+			found = true
+			continue
+		}
+		rest = append(rest, arg)
+	}
+	return rest, found
+}
+
+// popValue removes "--name value" or "--name=value" from args and returns the
+// value. ok is false when the flag is absent or has no value.
+func popValue(args []string, name string) (rest []string, value string, ok bool) {
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		switch {
+		case strings.HasPrefix(arg, name+"="):
+			value, ok = strings.TrimPrefix(arg, name+"="), true
+		case arg == name && i+1 < len(args):
+			value, ok = args[i+1], true
+			i++
+		case arg == name:
+			// flag given without a value
+		default:
+			rest = append(rest, arg)
+		}
+	}
+	return rest, value, ok
+}
@@ -0,0 +1,313 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/lib/pq"
+)
+
+// --- Schema audits ---
+func runMissingFKIndexes(db *sql.DB, args []string) {
+	_, emitSQL := popFlag(args, "--emit-sql")
+	if !emitSQL {
+		infof("{🔎 } Checking foreign keys for supporting indexes...")
+	}
+
+	// An FK is covered when some index starts with exactly its columns
+	// (in any order), which is what the planner needs for cascades.
+	rows, err := db.Query(`
+		SELECT
+			c.conrelid::regclass::text,
+			c.conname,
+			string_agg(a.attname, ', ' ORDER BY k.n),
+			string_agg(quote_ident(a.attname), ', ' ORDER BY k.n)
+		FROM pg_constraint c
+		CROSS JOIN LATERAL unnest(c.conkey) WITH ORDINALITY AS k(attnum, n)
+		JOIN pg_attribute a ON a.attrelid = c.conrelid AND a.attnum = k.attnum
+		WHERE c.contype = 'f'
+		  AND NOT EXISTS (
+			SELECT 1
+			FROM pg_index i
+			WHERE i.indrelid = c.conrelid
+			  AND (string_to_array(i.indkey::text, ' ')::int2[])[1:array_length(c.conkey, 1)] @> c.conkey
+		  )
+		GROUP BY c.conrelid, c.conname
+		ORDER BY 1, 2;
+	`)
+	if err != nil {
+		fmt.Fprintf(stdout, "{⚠️  } Failed to check foreign keys: %v\n", err)
+		exit(1)
+	}
+	defer rows.Close()
+
+	found := 0
+	for rows.Next() {
+		var table, constraint, columns, quoted string
+		if err := rows.Scan(&table, &constraint, &columns, &quoted); err != nil {
+			fmt.Fprintf(stdout, "{⚠️  } Failed to read foreign key: %v\n", err)
+			continue
+		}
+		found++
+		noteWarning()
+		if emitSQL {
+			fmt.Fprintf(output, "CREATE INDEX ON %s (%s);\n", table, quoted)
+			continue
+		}
+		fmt.Fprintf(output, "    🐢  %s (%s) | constraint: %s\n", table, columns, constraint)
+	}
+
+	if emitSQL {
+		return
+	}
+	if found == 0 {
+		fmt.Fprintln(stdout, "{✅ } Every foreign key has a supporting index")
+		return
+	}
+	fmt.Fprintf(stdout, "\n{⚠️  } %d foreign key(s) without a supporting index\n", found)
+	fmt.Fprintln(stdout, "    Run with --emit-sql to print CREATE INDEX statements")
+}
+
+func runNoPrimaryKey(db *sql.DB, args []string) {
+	_, emitSQL := popFlag(args, "--emit-sql")
+	if !emitSQL {
+		infof("{🔎 } Checking public tables for primary keys...")
+	}
+
+	// The suggested key column is id, or id_1, id_2, ... when the table
+	// already has a column by that name.
+	rows, err := db.Query(`
+		SELECT c.oid::regclass::text, (
+			SELECT s.name
+			FROM (
+				SELECT i, CASE WHEN i = 0 THEN 'id' ELSE 'id_' || i END AS name
+				FROM generate_series(0, 100) i
+			) s
+			WHERE NOT EXISTS (
+				SELECT 1
+				FROM pg_attribute a
+				WHERE a.attrelid = c.oid AND a.attname = s.name AND NOT a.attisdropped
+			)
+			ORDER BY s.i
+			LIMIT 1
+		)
+		FROM pg_class c
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		WHERE n.nspname = 'public'
+		  AND c.relkind IN ('r', 'p')
+		  AND NOT EXISTS (
+			SELECT 1
+			FROM pg_constraint k
+			WHERE k.conrelid = c.oid AND k.contype = 'p'
+		  )
+		ORDER BY 1;
+	`)
+	if err != nil {
+		fmt.Fprintf(stdout, "{⚠️  } Failed to check primary keys: %v\n", err)
+		exit(1)
+	}
+	defer rows.Close()
+
+	found := 0
+	for rows.Next() {
+		var table, column string
+		if err := rows.Scan(&table, &column); err != nil {
+			fmt.Fprintf(stdout, "{⚠️  } Failed to read table: %v\n", err)
+			continue
+		}
+		found++
+		noteWarning()
+		if emitSQL {
+			fmt.Fprintf(output, "ALTER TABLE %s ADD COLUMN %s bigint GENERATED ALWAYS AS IDENTITY PRIMARY KEY;\n", table, pq.QuoteIdentifier(column))
+			continue
+		}
+		fmt.Fprintf(output, "    🔓  %s\n", table)
+	}
+
+	if emitSQL {
+		return
+	}
+	if found == 0 {
+		fmt.Fprintln(stdout, "{✅ } Every public table has a primary key")
+		return
+	}
+	fmt.Fprintf(stdout, "\n{⚠️  } %d table(s) without a primary key\n", found)
+	fmt.Fprintln(stdout, "    Run with --emit-sql to print surrogate key suggestions")
+}
+
+// runVacuumStatus ranks user tables by dead-tuple ratio and flags those
+// above --threshold percent (default 20).
+func runVacuumStatus(db *sql.DB, args []string) {
+	_, thresholdStr, hasThreshold := popValue(args, "--threshold")
+	threshold := 20.0
+	if hasThreshold {
+		t, err := strconv.ParseFloat(thresholdStr, 64)
+		if err != nil || t < 0 || t > 100 {
+			fmt.Fprintln(stdout, "{⚠️  } --threshold expects a percentage between 0 and 100")
+			exit(1)
+		}
+		threshold = t
+	}
+
+	rows, err := db.Query(`
+		SELECT relname, n_live_tup, n_dead_tup,
+		       coalesce(100.0 * n_dead_tup / nullif(n_live_tup + n_dead_tup, 0), 0),
+		       last_vacuum, last_autovacuum
+		FROM pg_stat_user_tables
+		ORDER BY 4 DESC, n_dead_tup DESC, relname;
+	`)
+	if err != nil {
+		fmt.Fprintf(stdout, "{⚠️  } Failed to read table statistics: %v\n", err)
+		exit(1)
+	}
+	defer rows.Close()
+
+	lastRun := func(t sql.NullTime) string {
+		if !t.Valid {
+			return "never"
+		}
+		return formatValue(t.Time)
+	}
+
+	var data [][]string
+	flagged := 0
+	for rows.Next() {
+		var table string
+		var live, dead int64
+		var ratio float64
+		var vacuum, autovacuum sql.NullTime
+		if err := rows.Scan(&table, &live, &dead, &ratio, &vacuum, &autovacuum); err != nil {
+			fmt.Fprintf(stdout, "{⚠️  } Failed to read table: %v\n", err)
+			continue
+		}
+
+		needsVacuum := ""
+		if ratio > threshold {
+			needsVacuum = "yes"
+			flagged++
+			noteWarning()
+		}
+		data = append(data, []string{
+			table,
+			strconv.FormatInt(live, 10),
+			strconv.FormatInt(dead, 10),
+			fmt.Sprintf("%.1f%%", ratio),
+			lastRun(vacuum),
+			lastRun(autovacuum),
+			needsVacuum,
+		})
+	}
+
+	if len(data) == 0 {
+		fmt.Fprintln(stdout, "{⚠️  } No user tables found")
+		exitIfEmpty()
+		return
+	}
+
+	renderTable([]string{"table", "live", "dead", "dead %", "last_vacuum", "last_autovacuum", "needs vacuum"}, data)
+	if flagged > 0 {
+		fmt.Fprintf(stdout, "{⚠️  } %d table(s) above %.0f%% dead tuples, consider VACUUM\n", flagged, threshold)
+	} else {
+		fmt.Fprintf(stdout, "{✅ } No table above %.0f%% dead tuples\n", threshold)
+	}
+}
+
+// --- Write check ---
+
+// runTestWrite checks whether the role could create, fill and drop a table
+// in public. Every step runs in one transaction that is always rolled back,
+// so nothing is left behind; after a failure the rest are skipped.
+func runTestWrite(db *sql.DB) {
+	table := fmt.Sprintf("%s.%s", pq.QuoteIdentifier("public"), pq.QuoteIdentifier(fmt.Sprintf("hvmd_write_test_%d", os.Getpid())))
+	infof("{🧪 } Checking write access with %s (rolled back)...", table)
+
+	tx, err := db.BeginTx(interruptCtx, nil)
+	if err != nil {
+		fmt.Fprintf(stdout, "{⚠️  } Failed to start transaction: %v\n", err)
+		exit(1)
+	}
+	defer tx.Rollback()
+
+	steps := []struct{ name, stmt string }{
+		{"CREATE TABLE", "CREATE TABLE " + table + " (id int);"},
+		{"INSERT", "INSERT INTO " + table + " VALUES (1);"},
+		{"DELETE", "DELETE FROM " + table + ";"},
+		{"DROP TABLE", "DROP TABLE " + table + ";"},
+	}
+	failed := false
+	for _, step := range steps {
+		if failed {
+			fmt.Fprintf(output, "    %-12s skipped\n", step.name)
+			continue
+		}
+		if _, err := tx.Exec(step.stmt); err != nil {
+			fmt.Fprintf(output, "    %-12s failed: %v\n", step.name, err)
+			failed = true
+			continue
+		}
+		fmt.Fprintf(output, "    %-12s ok\n", step.name)
+	}
+
+	if err := tx.Rollback(); err != nil {
+		fmt.Fprintf(stdout, "{⚠️  } Rollback failed: %v\n", err)
+		exit(1)
+	}
+	if failed {
+		fmt.Fprintln(stdout, "{⚠️  } This role cannot write to public; changes were rolled back")
+		exit(1)
+	}
+	fmt.Fprintln(stdout, "{✅ } This role can write to public; changes were rolled back")
+}
+
+// --- Superuser audit ---
+
+// runAuditSuperusers lists superusers and warns when there are more than
+// HVMD_MAX_SUPERUSERS (default 3). Superusers that can log in are flagged
+// separately: those are the ones a leaked password turns into full control.
+func runAuditSuperusers(db *sql.DB) {
+	limit := envInt("HVMD_MAX_SUPERUSERS", 3)
+	infof("{🔎 } Auditing superuser roles...")
+
+	rows, err := db.Query(`
+		SELECT rolname, rolcanlogin
+		FROM pg_roles
+		WHERE rolsuper
+		ORDER BY rolname;
+	`)
+	if err != nil {
+		fmt.Fprintf(stdout, "{⚠️  } Failed to read superusers: %v\n", err)
+		exit(1)
+	}
+	defer rows.Close()
+
+	count, canLogin := 0, 0
+	for rows.Next() {
+		var name string
+		var login bool
+		if err := rows.Scan(&name, &login); err != nil {
+			fmt.Fprintf(stdout, "{⚠️  } Failed to read role: %v\n", err)
+			continue
+		}
+		count++
+		if login {
+			canLogin++
+			noteWarning()
+			fmt.Fprintf(output, "    ☢️  %s | can log in\n", name)
+			continue
+		}
+		fmt.Fprintf(output, "    🔑  %s | no login\n", name)
+	}
+
+	fmt.Fprintln(stdout, "")
+	if count > limit {
+		noteWarning()
+		fmt.Fprintf(stdout, "{⚠️  } %d superuser(s), more than the allowed %d (HVMD_MAX_SUPERUSERS)\n", count, limit)
+	} else {
+		fmt.Fprintf(stdout, "{✅ } %d superuser(s), within the allowed %d\n", count, limit)
+	}
+	if canLogin > 0 {
+		fmt.Fprintf(stdout, "{⚠️  } %d superuser(s) can log in; prefer NOLOGIN superusers reached through SET ROLE\n", canLogin)
+	}
+}
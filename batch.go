@@ -0,0 +1,129 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// --- Batch runbooks ---
+func runBatch(path string, continueOnError, coreRequested bool, db *sql.DB, user string) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		fmt.Fprintf(stdout, "(X) Failed to read batch file: %v\n", err)
+		exit(1)
+	}
+
+	sessionCore := coreEnabled
+	ran, failed := 0, 0
+
+	inBatch = true
+	for i, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fmt.Fprintln(stdout, "")
+		fmt.Fprintf(stdout, "(>) [line %d] hvmd %s\n", i+1, line)
+		ran++
+
+		code := runBatchLine(line, sessionCore, db, user)
+		if code == 0 {
+			continue
+		}
+		failed++
+		fmt.Fprintf(stdout, "(X) Line %d failed with exit code %d\n", i+1, code)
+		if !continueOnError {
+			break
+		}
+	}
+	inBatch = false
+	coreEnabled = sessionCore
+
+	fmt.Fprintln(stdout, "")
+	if failed > 0 {
+		fmt.Fprintf(stdout, "(X) Batch finished: %d run, %d failed\n", ran, failed)
+		exit(1)
+	}
+	fmt.Fprintf(stdout, "(✓) Batch finished: %d run, all succeeded\n", ran)
+}
+
+// runBatchLine executes one runbook line and returns the exit code it asked
+// for. --core behaves as on the command line, so lines without it run with
+// normal privileges even in a core session.
+func runBatchLine(line string, sessionCore bool, db *sql.DB, user string) int {
+	fields, err := splitCommandLine(line)
+	if err != nil {
+		fmt.Fprintf(stdout, "(!) %v\n", err)
+		return 1
+	}
+
+	fields, lineCore := popFlag(fields, "--core")
+	if lineCore && !sessionCore {
+		fmt.Fprintln(stdout, "(!) Unknown command: --core")
+		return 1
+	}
+	if len(fields) == 0 {
+		return 0
+	}
+
+	coreEnabled = lineCore
+	return runStep(func() { dispatch(fields[0], fields[1:], db, user) })
+}
+
+// runStep runs one batch or shell step and returns the exit code it asked
+// for, instead of letting exit() end the whole session.
+func runStep(step func()) (code int) {
+	defer func() {
+		if r := recover(); r != nil {
+			c, ok := r.(exitCode)
+			if !ok {
+				panic(r)
+			}
+			code = int(c)
+		}
+	}()
+
+	step()
+	return 0
+}
+
+// splitCommandLine splits a line into arguments, honouring single and double
+// quotes so SQL can be passed as one argument.
+func splitCommandLine(line string) ([]string, error) {
+	var fields []string
+	var cur strings.Builder
+	var quote rune
+	inField := false
+
+	for _, r := range line {
+		switch {
+		case quote != 0 && r == quote:
+			quote = 0
+		case quote != 0:
+			cur.WriteRune(r)
+		case r == '"' || r == '\'':
+			quote = r
+			inField = true
+		case r == ' ' || r == '\t':
+			if inField {
+				fields = append(fields, cur.String())
+				cur.Reset()
+				inField = false
+			}
+		default:
+			cur.WriteRune(r)
+			inField = true
+		}
+	}
+
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated %c quote", quote)
+	}
+	if inField {
+		fields = append(fields, cur.String())
+	}
+	return fields, nil
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// --- Command registry ---
+//
+// These lists are the single source of truth for command names: dispatch and
+// handleCoreCommand route them, suggestSimilar and completion read them.
+
+// publicCommands are available without --core.
+var publicCommands = []string{"help", "version", "profiles", "query-history", "ping", "admins", "users", "databases", "extensions", "doctor", "encoding-check", "functions", "views", "whoami", "tables", "readdb", "addadminsshkey", "catssh", "rotatessh", "shell", "connstring", "healthcheck", "completion", "describe"}
+
+// coreCommands require --core and core access.
+var coreCommands = []string{"identify", "testssh", "readdb", "missing-fk-indexes", "export-roles", "set-connlimit", "activity", "locks", "no-primary-key", "query", "export-schema", "grant-core", "revoke-core", "core-users", "sizes", "peek", "kill", "cancel", "backup-roles", "sequences", "grants", "vacuum-status", "dump", "schema-diff", "test-write", "roles-tree", "settings", "kill-idle", "audit-superusers"}
+
+// globalFlags are the flags main understands before any command.
+var globalFlags = []string{"--core", "--explain-access", "--json", "--json-pretty", "--counts", "--verbose", "--trace", "--quiet", "--fail-on-empty", "--no-warnings", "--exit-on-warning", "--tee", "--no-emoji", "--no-color", "--pager", "--no-pager", "--format", "--table-style", "--output", "--env-file", "--profile", "--host", "--port", "--user", "--dbname", "--sslmode", "--password-stdin", "--password-prompt", "--retries", "--retry-delay", "--timeout", "--tunnel", "--watch", "--batch", "--continue-on-error"}
+
+func isCoreCommand(cmd string) bool {
+	for _, c := range coreCommands {
+		if c == cmd {
+			return true
+		}
+	}
+	return false
+}
+
+// knownCommands returns the commands the current session may run, without
+// duplicates. Core commands are only listed once core access is confirmed.
+func knownCommands(withCore bool) []string {
+	names := append([]string{}, publicCommands...)
+	if !withCore {
+		return names
+	}
+	for _, c := range coreCommands {
+		if !slices.Contains(names, c) {
+			names = append(names, c)
+		}
+	}
+	return names
+}
+
+// --- Shell completion ---
+func showCompletion(args []string, withCore bool) {
+	if len(args) != 1 {
+		fmt.Fprintln(stdout, "(!) Usage: hvmd completion <bash|zsh|fish>")
+		exit(1)
+	}
+
+	cmds := strings.Join(knownCommands(withCore), " ")
+	flags := strings.Join(globalFlags, " ")
+
+	switch args[0] {
+	case "bash":
+		fmt.Fprintf(output, `# hvmd bash completion: source <(hvmd completion bash)
+_hvmd() {
+    local cur=${COMP_WORDS[COMP_CWORD]}
+    if [[ $cur == -* ]]; then
+        COMPREPLY=($(compgen -W "%s" -- "$cur"))
+    else
+        COMPREPLY=($(compgen -W "%s" -- "$cur"))
+    fi
+}
+complete -F _hvmd hvmd
+`, flags, cmds)
+	case "zsh":
+		fmt.Fprintf(output, `#compdef hvmd
+# hvmd zsh completion: source <(hvmd completion zsh)
+_hvmd() {
+    if [[ $PREFIX == -* ]]; then
+        compadd -- %s
+    else
+        compadd -- %s
+    fi
+}
+compdef _hvmd hvmd
+`, flags, cmds)
+	case "fish":
+		fmt.Fprintln(output, "# hvmd fish completion: hvmd completion fish | source")
+		fmt.Fprintln(output, "complete -c hvmd -f")
+		fmt.Fprintf(output, "complete -c hvmd -n __fish_use_subcommand -a %q\n", cmds)
+		for _, f := range globalFlags {
+			fmt.Fprintf(output, "complete -c hvmd -l %s\n", strings.TrimPrefix(f, "--"))
+		}
+	default:
+		fmt.Fprintf(stdout, "(!) Unsupported shell %q, expected bash, zsh or fish\n", args[0])
+		exit(1)
+	}
+}
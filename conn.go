@@ -0,0 +1,520 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	"golang.org/x/term"
+)
+
+// --- Connection settings ---
+
+// sslModes are the sslmode values lib/pq understands.
+var sslModes = []string{"disable", "require", "verify-ca", "verify-full"}
+
+func isValidSSLMode(mode string) bool {
+	for _, m := range sslModes {
+		if m == mode {
+			return true
+		}
+	}
+	return false
+}
+
+// connectTimeout reads POSTGRES_CONNECT_TIMEOUT in seconds, defaulting to 10.
+func connectTimeout() time.Duration {
+	if v := os.Getenv("POSTGRES_CONNECT_TIMEOUT"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			return time.Duration(n) * time.Second
+		}
+		fmt.Fprintf(stdout, "(!) Ignoring invalid POSTGRES_CONNECT_TIMEOUT %q, using 10s\n", v)
+	}
+	return 10 * time.Second
+}
+
+// configurePool sizes the connection pool. A CLI needs very few connections;
+// the lifetime cap keeps shell and --watch sessions from holding stale ones.
+// HVMD_MAX_CONNS, HVMD_MAX_IDLE_CONNS and HVMD_CONN_MAX_LIFETIME override.
+func configurePool(db *sql.DB) {
+	maxConns := envInt("HVMD_MAX_CONNS", 4)
+	maxIdle := min(envInt("HVMD_MAX_IDLE_CONNS", 2), maxConns)
+	lifetime := 5 * time.Minute
+	if v := os.Getenv("HVMD_CONN_MAX_LIFETIME"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil && d > 0 {
+			lifetime = d
+		} else {
+			fmt.Fprintf(stdout, "(!) Ignoring invalid HVMD_CONN_MAX_LIFETIME %q, using %s\n", v, lifetime)
+		}
+	}
+
+	db.SetMaxOpenConns(maxConns)
+	db.SetMaxIdleConns(maxIdle)
+	db.SetConnMaxLifetime(lifetime)
+	debugf("pool: max %d open, %d idle, lifetime %s", maxConns, maxIdle, lifetime)
+}
+
+// envInt reads a positive integer setting, falling back to def.
+func envInt(name string, def int) int {
+	v := os.Getenv(name)
+	if v == "" {
+		return def
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n <= 0 {
+		fmt.Fprintf(stdout, "(!) Ignoring invalid %s %q, using %d\n", name, v, def)
+		return def
+	}
+	return n
+}
+
+// applicationName labels our sessions in pg_stat_activity: HVMD_APP_NAME
+// (default "hvmd") plus the command being run.
+func applicationName(cmd string) string {
+	name := os.Getenv("HVMD_APP_NAME")
+	if name == "" {
+		name = "hvmd"
+	}
+	if cmd != "" {
+		name += " " + cmd
+	}
+	return name
+}
+
+// buildDSN assembles the lib/pq connection URL from the resolved settings.
+// url.URL does the escaping, so passwords containing @, : or / and IPv6
+// hosts survive intact. A host starting with "/" is a Unix socket directory;
+// it and the port go in the query string instead of the authority.
+func buildDSN(user, password, host, port, dbname, sslmode, sslrootcert, appName string, timeout time.Duration) string {
+	q := url.Values{}
+	q.Set("sslmode", sslmode)
+	q.Set("connect_timeout", strconv.Itoa(int(timeout.Seconds())))
+	q.Set("application_name", appName)
+	if strings.HasPrefix(sslmode, "verify-") && sslrootcert != "" {
+		q.Set("sslrootcert", sslrootcert)
+	}
+
+	u := url.URL{
+		Scheme: "postgres",
+		User:   url.UserPassword(user, password),
+		Path:   "/" + dbname,
+	}
+	if isSocketHost(host) {
+		// lib/pq looks for <dir>/.s.PGSQL.<port>, so the port still matters.
+		q.Set("host", host)
+		q.Set("port", port)
+	} else {
+		u.Host = net.JoinHostPort(strings.Trim(host, "[]"), port)
+	}
+	u.RawQuery = q.Encode()
+	return u.String()
+}
+
+// isSocketHost reports whether host names a Unix socket directory.
+func isSocketHost(host string) bool {
+	return strings.HasPrefix(host, "/")
+}
+
+// databaseURL holds the settings carried by a DATABASE_URL.
+type databaseURL struct {
+	user, password, host, port, dbname, sslmode string
+}
+
+// parseDatabaseURL unpacks a postgres:// URL as handed out by most hosting
+// providers.
+func parseDatabaseURL(raw string) (databaseURL, error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return databaseURL{}, err
+	}
+	if u.Scheme != "postgres" && u.Scheme != "postgresql" {
+		return databaseURL{}, fmt.Errorf("unsupported scheme %q, want postgres://", u.Scheme)
+	}
+
+	d := databaseURL{
+		host:    u.Hostname(),
+		port:    u.Port(),
+		dbname:  strings.TrimPrefix(u.Path, "/"),
+		sslmode: u.Query().Get("sslmode"),
+	}
+	if u.User != nil {
+		d.user = u.User.Username()
+		d.password, _ = u.User.Password()
+	}
+	// lib/pq defaults to require when the URL doesn't say.
+	if d.sslmode == "" {
+		d.sslmode = "require"
+	}
+	return d, nil
+}
+
+// urlDSN returns DATABASE_URL as the DSN, adding connect_timeout and
+// application_name unless the URL sets its own.
+func urlDSN(raw, appName string, timeout time.Duration) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return raw
+	}
+	q := u.Query()
+	if q.Get("connect_timeout") == "" {
+		q.Set("connect_timeout", strconv.Itoa(int(timeout.Seconds())))
+	}
+	if q.Get("application_name") == "" {
+		q.Set("application_name", appName)
+	}
+	u.RawQuery = q.Encode()
+	return u.String()
+}
+
+// maskDSN replaces the password in a connection URL with **** for display.
+func maskDSN(dsn string) string {
+	u, err := url.Parse(dsn)
+	if err != nil || u.User == nil {
+		return dsn
+	}
+	if p, _ := u.User.Password(); p == "" {
+		return dsn
+	}
+	// url.UserPassword would percent-encode the stars.
+	u.User = url.User(u.User.Username())
+	return strings.Replace(u.String(), "@", ":****@", 1)
+}
+
+// reportConnError tells a network timeout apart from rejected credentials so
+// users know whether to check the network or their login.
+func reportConnError(err error, timeout time.Duration) {
+	var netErr net.Error
+	switch {
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		fmt.Fprintf(stdout, "(X) Timed out reaching the VOID after %s. Check the host, port and network.\n", timeout)
+	case isAuthError(err):
+		fmt.Fprintln(stdout, "(X) The VOID rejected your credentials. Check POSTGRES_USER and POSTGRES_PASSWORD.")
+	default:
+		fmt.Fprintln(stdout, "(X) Failed to connect to the VOID. Forcefield active.")
+	}
+}
+
+// isAuthError reports whether the server rejected the login itself, which no
+// amount of retrying will fix.
+func isAuthError(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code.Class() == "28"
+}
+
+// pingWithRetry pings up to retries+1 times, doubling delay between attempts.
+func pingWithRetry(db *sql.DB, timeout time.Duration, retries int, delay time.Duration) error {
+	for attempt := 0; ; attempt++ {
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		err := db.PingContext(ctx)
+		cancel()
+		if err == nil || attempt >= retries || isAuthError(err) {
+			return err
+		}
+		debugf("ping attempt %d failed: %v", attempt+1, err)
+		infof("(>) Retrying connection (%d/%d)...", attempt+1, retries)
+		time.Sleep(delay << attempt)
+	}
+}
+
+// parseRetryFlags reads --retries and --retry-delay. Retries default to 0 so
+// a failed ping still fails immediately unless asked otherwise.
+func parseRetryFlags(args []string) ([]string, int, time.Duration) {
+	args, n, hasRetries := popValue(args, "--retries")
+	args, d, hasDelay := popValue(args, "--retry-delay")
+
+	retries := 0
+	if hasRetries {
+		v, err := strconv.Atoi(n)
+		if err != nil || v < 0 {
+			fmt.Fprintln(stdout, "(!) --retries expects a non-negative number")
+			exit(1)
+		}
+		retries = v
+	}
+
+	delay := time.Second
+	if hasDelay {
+		v, err := time.ParseDuration(d)
+		if err != nil || v <= 0 {
+			fmt.Fprintln(stdout, "(!) --retry-delay expects a duration such as 500ms or 2s")
+			exit(1)
+		}
+		delay = v
+	}
+	return args, retries, delay
+}
+
+// readPasswordFile reads a password kept outside .env, e.g. a mounted secret.
+func readPasswordFile(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
+
+// readPasswordStdin reads one line from stdin for --password-stdin.
+func readPasswordStdin() (string, error) {
+	line, err := stdinReader.ReadString('\n')
+	if err != nil && (err != io.EOF || line == "") {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// promptPassword asks for the password on the terminal without echo. It
+// refuses to read from a pipe, where it would silently wait for input.
+func promptPassword(user string) (string, error) {
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return "", errors.New("--password-prompt needs an interactive terminal; use --password-stdin for piped input")
+	}
+	fmt.Fprintf(stderr, "Password for %s: ", user)
+	p, err := term.ReadPassword(fd)
+	fmt.Fprintln(stderr)
+	if err != nil {
+		return "", fmt.Errorf("failed to read password: %w", err)
+	}
+	return string(p), nil
+}
+
+// reportMissingConfig names the required connection settings that are unset,
+// so a first run without .env isn't mistaken for a network problem.
+func reportMissingConfig(user, password, dbname string) {
+	var missing []string
+	if user == "" {
+		missing = append(missing, "POSTGRES_USER (--user)")
+	}
+	if password == "" {
+		missing = append(missing, "POSTGRES_PASSWORD (--password-stdin)")
+	}
+	if dbname == "" {
+		missing = append(missing, "POSTGRES_DB (--dbname)")
+	}
+
+	fmt.Fprintf(stdout, "(X) Missing database configuration: %s\n", strings.Join(missing, ", "))
+	fmt.Fprintln(stdout, "    Set them in .env or the environment, pass the flags, use --profile, or pass --env-file=<path>")
+}
+
+// isConnError reports whether err means the connection itself is gone, as
+// opposed to a problem with one query or row.
+func isConnError(err error) bool {
+	if err == nil {
+		return false
+	}
+	var netErr net.Error
+	var pqErr *pq.Error
+	switch {
+	case errors.Is(err, driver.ErrBadConn), errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+		return true
+	case errors.As(err, &netErr):
+		return !netErr.Timeout()
+	case errors.As(err, &pqErr):
+		// Class 08: connection exception; 57P01-03: server shutting down.
+		return pqErr.Code.Class() == "08" || pqErr.Code == "57P01" || pqErr.Code == "57P02" || pqErr.Code == "57P03"
+	}
+	return false
+}
+
+// reconnect checks the pool can reach the server again. database/sql drops
+// broken connections itself, so a successful ping means a fresh one.
+func reconnect(db *sql.DB) error {
+	ctx, cancel := context.WithTimeout(context.Background(), connectTimeout())
+	defer cancel()
+	return db.PingContext(ctx)
+}
+
+// openDB opens the pool for dsn, dialling through dialer when one is given
+// (as with --tunnel) and directly otherwise. Under --trace every statement
+// is logged.
+func openDB(dsn string, dialer pq.Dialer) (*sql.DB, error) {
+	if dialer == nil && !traceSQL {
+		return sql.Open("postgres", dsn)
+	}
+	c, err := pq.NewConnector(dsn)
+	if err != nil {
+		return nil, err
+	}
+	if dialer != nil {
+		c.Dialer(dialer)
+	}
+	if traceSQL {
+		return sql.OpenDB(traceConnector{c}), nil
+	}
+	return sql.OpenDB(c), nil
+}
+
+// --- Query timeouts ---
+
+// queryTimeout bounds individual introspection queries when --timeout is set.
+var queryTimeout time.Duration
+
+// interruptCtx is cancelled on Ctrl-C. Every queryContext derives from it,
+// so the statement in flight is cancelled on the server as well.
+var interruptCtx, cancelQueries = context.WithCancel(context.Background())
+
+// queryContext returns the context a query should run under: bounded by
+// --timeout when set, unbounded otherwise, and cancelled by Ctrl-C.
+func queryContext() (context.Context, context.CancelFunc) {
+	if queryTimeout > 0 {
+		return context.WithTimeout(interruptCtx, queryTimeout)
+	}
+	return context.WithCancel(interruptCtx)
+}
+
+// handleInterrupt turns Ctrl-C into an orderly stop: cancel the running
+// query, close db and exit with exitInterrupted. --watch handles Ctrl-C
+// itself and doesn't install this.
+func handleInterrupt(db *sql.DB) {
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt)
+	go func() {
+		<-sigs
+		cancelQueries()
+
+		// Close waits on queries that didn't take a context; don't let one
+		// of those hold the exit hostage.
+		closed := make(chan struct{})
+		go func() {
+			db.Close()
+			close(closed)
+		}()
+		select {
+		case <-closed:
+		case <-time.After(2 * time.Second):
+		}
+
+		fmt.Fprintln(stderr, "\n(!) Cancelled")
+		finishPager()
+		writeAudit(exitInterrupted)
+		os.Exit(exitInterrupted)
+	}()
+}
+
+// isQueryTimeout reports whether err came from --timeout expiring, either
+// client side or as the server's cancellation of the statement.
+func isQueryTimeout(err error) bool {
+	var pqErr *pq.Error
+	return errors.Is(err, context.DeadlineExceeded) ||
+		(queryTimeout > 0 && errors.As(err, &pqErr) && pqErr.Code == "57014")
+}
+
+func describeQueryErr(err error) string {
+	if isQueryTimeout(err) {
+		return fmt.Sprintf("query exceeded timeout (%s)", queryTimeout)
+	}
+	return err.Error()
+}
+
+// --- Connection profiles ---
+
+// profile is one named entry in ~/.hvmd/profiles.json.
+type profile struct {
+	Host     string `json:"host"`
+	Port     string `json:"port"`
+	User     string `json:"user"`
+	Password string `json:"password"`
+	DBName   string `json:"dbname"`
+	SSLMode  string `json:"sslmode"`
+}
+
+func profilesPath() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".hvmd", "profiles.json")
+}
+
+func loadProfiles() (map[string]profile, error) {
+	data, err := os.ReadFile(profilesPath())
+	if err != nil {
+		return nil, err
+	}
+	var profiles map[string]profile
+	if err := json.Unmarshal(data, &profiles); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", profilesPath(), err)
+	}
+	return profiles, nil
+}
+
+func mustLoadProfile(name string) profile {
+	profiles, err := loadProfiles()
+	if err != nil {
+		fmt.Fprintf(stdout, "(X) Failed to load profiles: %v\n", err)
+		exit(1)
+	}
+	p, ok := profiles[name]
+	if !ok {
+		fmt.Fprintf(stdout, "(X) No profile named %q in %s\n", name, profilesPath())
+		fmt.Fprintln(stdout, "    Try: hvmd profiles")
+		exit(1)
+	}
+	return p
+}
+
+// openProfile connects with the named profile, for commands that work on a
+// second database next to the main connection.
+func openProfile(name string) *sql.DB {
+	p := mustLoadProfile(name)
+	host, port, sslmode := p.Host, p.Port, p.SSLMode
+	if host == "" {
+		host = "localhost"
+	}
+	if port == "" {
+		port = "5432"
+	}
+	if sslmode == "" {
+		sslmode = "disable"
+	}
+
+	dsn := buildDSN(p.User, p.Password, host, port, p.DBName, sslmode, "", applicationName("schema-diff"), connectTimeout())
+	db, err := openDB(dsn, nil)
+	if err == nil {
+		err = db.Ping()
+	}
+	if err != nil {
+		fmt.Fprintf(stdout, "(X) Failed to connect with profile %s: %v\n", name, err)
+		exit(1)
+	}
+	return db
+}
+
+func showProfiles() {
+	profiles, err := loadProfiles()
+	if os.IsNotExist(err) {
+		fmt.Fprintf(stdout, "(!) No profiles configured (%s)\n", profilesPath())
+		exitIfEmpty()
+		return
+	}
+	if err != nil {
+		fmt.Fprintf(stdout, "(X) Failed to load profiles: %v\n", err)
+		exit(1)
+	}
+
+	names := make([]string, 0, len(profiles))
+	for name := range profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fmt.Fprintln(output, "(✓) Profiles:")
+	for _, name := range names {
+		p := profiles[name]
+		fmt.Fprintf(output, "  (-) %-20s %s@%s:%s/%s\n", name, p.User, p.Host, p.Port, p.DBName)
+	}
+}
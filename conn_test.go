@@ -0,0 +1,53 @@
+package main
+
+import (
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestBuildDSNRoundTrip(t *testing.T) {
+	tests := []struct {
+		name                               string
+		user, password, host, port, dbname string
+	}{
+		{"plain", "app", "secret", "db.example.com", "5432", "appdb"},
+		{"reserved characters in password", "app", "p@ss:w/rd?#%", "db.example.com", "6543", "appdb"},
+		{"ipv6 host", "app", "secret", "::1", "5432", "appdb"},
+		{"socket host", "app", "p@ss:w/rd", "/var/run/postgresql", "5433", "appdb"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dsn := buildDSN(tt.user, tt.password, tt.host, tt.port, tt.dbname, "disable", "", "hvmd test", 10*time.Second)
+			u, err := url.Parse(dsn)
+			if err != nil {
+				t.Fatalf("url.Parse(%q): %v", dsn, err)
+			}
+
+			if got := u.User.Username(); got != tt.user {
+				t.Errorf("user = %q, want %q", got, tt.user)
+			}
+			if got, _ := u.User.Password(); got != tt.password {
+				t.Errorf("password = %q, want %q", got, tt.password)
+			}
+			if got := u.Path; got != "/"+tt.dbname {
+				t.Errorf("path = %q, want %q", got, "/"+tt.dbname)
+			}
+
+			host, port := u.Hostname(), u.Port()
+			if isSocketHost(tt.host) {
+				if u.Host != "" {
+					t.Errorf("authority = %q, want empty for a socket host", u.Host)
+				}
+				host, port = u.Query().Get("host"), u.Query().Get("port")
+			}
+			if host != tt.host {
+				t.Errorf("host = %q, want %q", host, tt.host)
+			}
+			if port != tt.port {
+				t.Errorf("port = %q, want %q", port, tt.port)
+			}
+		})
+	}
+}
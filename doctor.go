@@ -0,0 +1,325 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// runHealthcheck is the probe for cron and monitors: connect, ping and
+// SELECT 1 within the connection timeout, then print one OK or FAIL line
+// and exit 0 or exitUnhealthy.
+func runHealthcheck(dsn string, timeout time.Duration, configured bool) {
+	fail := func(reason string) {
+		fmt.Fprintf(stdout, "FAIL %s\n", reason)
+		exit(exitUnhealthy)
+	}
+	if !configured {
+		fail("missing database configuration")
+	}
+
+	start := time.Now()
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	db, err := openDB(dsn, nil)
+	if err != nil {
+		fail(err.Error())
+	}
+	defer db.Close()
+
+	if err := db.PingContext(ctx); err != nil {
+		fail(err.Error())
+	}
+	var one int
+	if err := db.QueryRowContext(ctx, "SELECT 1;").Scan(&one); err != nil {
+		fail(err.Error())
+	}
+
+	fmt.Fprintf(stdout, "OK %s\n", time.Since(start).Round(time.Millisecond))
+}
+
+// --- Health checks ---
+type checkStatus int
+
+const (
+	checkPass checkStatus = iota
+	checkWarn
+	checkFail
+)
+
+func (s checkStatus) String() string {
+	switch s {
+	case checkPass:
+		return "PASS"
+	case checkWarn:
+		return "WARN"
+	default:
+		return "FAIL"
+	}
+}
+
+type doctorCheck struct {
+	name string
+	run  func(db *sql.DB) (checkStatus, string)
+}
+
+var doctorChecks = []doctorCheck{
+	{"connectivity", checkConnectivity},
+	{"connection headroom", checkConnectionHeadroom},
+	{"idle in transaction", checkIdleInTransaction},
+	{"long-running queries", checkLongRunning},
+	{"replication", checkReplication},
+	{"table statistics", checkStaleStats},
+}
+
+func runDoctor(db *sql.DB) {
+	infof("(>) Running health checks")
+
+	worst := checkPass
+	for _, c := range doctorChecks {
+		status, detail := c.run(db)
+		if status > worst {
+			worst = status
+		}
+		if status == checkWarn {
+			noteWarning()
+		}
+		fmt.Fprintf(output, "  [%s] %-22s %s\n", status, c.name, detail)
+	}
+
+	fmt.Fprintln(stdout, "")
+	switch worst {
+	case checkPass:
+		fmt.Fprintln(stdout, "(✓) Verdict: healthy")
+	case checkWarn:
+		fmt.Fprintln(stdout, "(!) Verdict: healthy with warnings")
+	default:
+		fmt.Fprintln(stdout, "(X) Verdict: unhealthy")
+		exit(1)
+	}
+}
+
+func checkConnectivity(db *sql.DB) (checkStatus, string) {
+	start := time.Now()
+	var one int
+	if err := db.QueryRow("SELECT 1;").Scan(&one); err != nil {
+		return checkFail, err.Error()
+	}
+	return checkPass, fmt.Sprintf("round trip %s", time.Since(start).Round(time.Millisecond))
+}
+
+func checkConnectionHeadroom(db *sql.DB) (checkStatus, string) {
+	var used, limit int
+	err := db.QueryRow(`
+		SELECT
+			(SELECT count(*) FROM pg_stat_activity),
+			current_setting('max_connections')::int;
+	`).Scan(&used, &limit)
+	if err != nil {
+		return checkFail, err.Error()
+	}
+
+	detail := fmt.Sprintf("%d of %d connections in use", used, limit)
+	switch pct := used * 100 / limit; {
+	case pct >= 95:
+		return checkFail, detail
+	case pct >= 80:
+		return checkWarn, detail
+	}
+	return checkPass, detail
+}
+
+func checkIdleInTransaction(db *sql.DB) (checkStatus, string) {
+	var n int
+	err := db.QueryRow(`
+		SELECT count(*)
+		FROM pg_stat_activity
+		WHERE state LIKE 'idle in transaction%';
+	`).Scan(&n)
+	if err != nil {
+		return checkFail, err.Error()
+	}
+	if n > 0 {
+		return checkWarn, fmt.Sprintf("%d session(s) idle in transaction", n)
+	}
+	return checkPass, "none"
+}
+
+func checkLongRunning(db *sql.DB) (checkStatus, string) {
+	var n int
+	err := db.QueryRow(`
+		SELECT count(*)
+		FROM pg_stat_activity
+		WHERE state = 'active'
+		  AND pid <> pg_backend_pid()
+		  AND now() - query_start > interval '5 minutes';
+	`).Scan(&n)
+	if err != nil {
+		return checkFail, err.Error()
+	}
+	if n > 0 {
+		return checkWarn, fmt.Sprintf("%d query(ies) running longer than 5m", n)
+	}
+	return checkPass, "none over 5m"
+}
+
+func checkReplication(db *sql.DB) (checkStatus, string) {
+	var inRecovery bool
+	if err := db.QueryRow("SELECT pg_is_in_recovery();").Scan(&inRecovery); err != nil {
+		return checkFail, err.Error()
+	}
+
+	if inRecovery {
+		var lag sql.NullFloat64
+		err := db.QueryRow(`
+			SELECT extract(epoch FROM now() - pg_last_xact_replay_timestamp());
+		`).Scan(&lag)
+		if err != nil {
+			return checkFail, err.Error()
+		}
+		if !lag.Valid {
+			return checkWarn, "standby, no transactions replayed yet"
+		}
+		detail := fmt.Sprintf("standby, replay lag %s", time.Duration(lag.Float64*float64(time.Second)).Round(time.Second))
+		if lag.Float64 > 300 {
+			return checkWarn, detail
+		}
+		return checkPass, detail
+	}
+
+	var standbys int
+	if err := db.QueryRow("SELECT count(*) FROM pg_stat_replication;").Scan(&standbys); err != nil {
+		return checkFail, err.Error()
+	}
+	if standbys == 0 {
+		return checkPass, "primary, no standbys attached"
+	}
+	return checkPass, fmt.Sprintf("primary, %d standby(s) streaming", standbys)
+}
+
+func checkStaleStats(db *sql.DB) (checkStatus, string) {
+	var n int
+	err := db.QueryRow(`
+		SELECT count(*)
+		FROM pg_stat_user_tables
+		WHERE n_mod_since_analyze > 0
+		  AND coalesce(greatest(last_analyze, last_autoanalyze), 'epoch') < now() - interval '7 days';
+	`).Scan(&n)
+	if err != nil {
+		return checkFail, err.Error()
+	}
+	if n > 0 {
+		return checkWarn, fmt.Sprintf("%d table(s) not analyzed in 7 days", n)
+	}
+	return checkPass, "all recently analyzed"
+}
+
+// --- Encoding ---
+func runEncodingCheck(db *sql.DB) {
+	var serverEnc, collate, ctype, clientEnc string
+	err := db.QueryRow(`
+		SELECT pg_encoding_to_char(encoding), datcollate, datctype
+		FROM pg_database
+		WHERE datname = current_database();
+	`).Scan(&serverEnc, &collate, &ctype)
+	if err != nil {
+		fmt.Fprintf(stdout, "(X) Failed to read database encoding: %v\n", err)
+		exit(1)
+	}
+	if err := db.QueryRow("SHOW client_encoding;").Scan(&clientEnc); err != nil {
+		fmt.Fprintf(stdout, "(X) Failed to read client encoding: %v\n", err)
+		exit(1)
+	}
+
+	fmt.Fprintln(output, "(✓) Encoding:")
+	fmt.Fprintf(output, "  (-) Database encoding: %s\n", serverEnc)
+	fmt.Fprintf(output, "  (-) Client encoding:   %s\n", clientEnc)
+	fmt.Fprintf(output, "  (-) Collation:         %s\n", collate)
+	fmt.Fprintf(output, "  (-) Ctype:             %s\n", ctype)
+	fmt.Fprintln(stdout, "")
+
+	if serverEnc != clientEnc || serverEnc == "SQL_ASCII" {
+		noteWarning()
+	}
+
+	switch {
+	case serverEnc == "SQL_ASCII":
+		fmt.Fprintln(stdout, "(!) Database uses SQL_ASCII: bytes are stored unvalidated and mixed encodings can go unnoticed")
+	case serverEnc != clientEnc && clientEnc == "SQL_ASCII":
+		fmt.Fprintln(stdout, "(!) Client sends SQL_ASCII: non-ASCII input is not converted and may be stored corrupted")
+	case serverEnc == "UTF8" && clientEnc != "UTF8":
+		fmt.Fprintf(stdout, "(!) Client encoding %s cannot represent all UTF8 data: reads may fail or lose characters\n", clientEnc)
+	case serverEnc != clientEnc:
+		fmt.Fprintf(stdout, "(!) Client (%s) and database (%s) encodings differ: text is converted on every round trip\n", clientEnc, serverEnc)
+	default:
+		fmt.Fprintln(stdout, "(✓) Client and database encodings match")
+	}
+}
+
+// --- Server settings ---
+
+// defaultSettings are the GUCs settings shows unless --names lists others.
+var defaultSettings = []string{
+	"max_connections", "shared_buffers", "effective_cache_size", "work_mem",
+	"maintenance_work_mem", "wal_level", "max_wal_size", "checkpoint_timeout",
+	"random_page_cost", "autovacuum", "statement_timeout",
+	"idle_in_transaction_session_timeout",
+}
+
+func showSettings(db *sql.DB, args []string) {
+	_, namesStr, hasNames := popValue(args, "--names")
+	names := defaultSettings
+	if hasNames {
+		names = nil
+		for _, n := range strings.Split(namesStr, ",") {
+			if n = strings.TrimSpace(n); n != "" {
+				names = append(names, n)
+			}
+		}
+		if len(names) == 0 {
+			fmt.Fprintln(stdout, "{⚠️  } --names expects a comma-separated list of settings")
+			exit(1)
+		}
+	}
+
+	rows, err := db.Query(`
+		SELECT name, setting, coalesce(unit, ''), source
+		FROM pg_settings
+		WHERE name = ANY($1)
+		ORDER BY array_position($1, name::text);
+	`, pq.Array(names))
+	if err != nil {
+		fmt.Fprintf(stdout, "{⚠️  } Failed to read settings: %v\n", err)
+		exit(1)
+	}
+	defer rows.Close()
+
+	var data [][]string
+	found := map[string]bool{}
+	for rows.Next() {
+		var name, setting, unit, source string
+		if err := rows.Scan(&name, &setting, &unit, &source); err != nil {
+			fmt.Fprintf(stdout, "{⚠️  } Failed to read setting: %v\n", err)
+			continue
+		}
+		found[name] = true
+		data = append(data, []string{name, setting, unit, source})
+	}
+
+	if len(data) > 0 {
+		renderTable([]string{"name", "setting", "unit", "source"}, data)
+	}
+	for _, n := range names {
+		if !found[n] {
+			fmt.Fprintf(stdout, "{⚠️  } No such setting: %s\n", n)
+		}
+	}
+	if len(data) == 0 {
+		exitIfEmpty()
+	}
+}
@@ -6,6 +6,7 @@ require (
 	github.com/joho/godotenv v1.5.1
 	github.com/lib/pq v1.10.9
 	golang.org/x/crypto v0.43.0
+	golang.org/x/term v0.36.0
 )
 
 require golang.org/x/sys v0.37.0 // indirect
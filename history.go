@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// --- Local query history (opt-in via HVMD_HISTORY=1) ---
+var historyPasswordRe = regexp.MustCompile(`(?i)(password\s+)'[^']*'`)
+
+func historyPath() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".hvmd_history")
+}
+
+// recordHistory appends an executed statement to the history file. Failures
+// are silent: history is a convenience and must never break a command.
+func recordHistory(stmt string) {
+	if os.Getenv("HVMD_HISTORY") != "1" {
+		return
+	}
+	path := historyPath()
+	if path == "" {
+		return
+	}
+
+	stmt = strings.Join(strings.Fields(stmt), " ")
+	stmt = historyPasswordRe.ReplaceAllString(stmt, "$1'****'")
+
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	fmt.Fprintf(f, "%s\t%s\n", time.Now().Format(time.RFC3339), stmt)
+}
+
+// --- Audit log (opt-in via HVMD_AUDIT_LOG=<path>) ---
+
+// audit describes this invocation for the audit log. main fills it in as the
+// command, role and core access are resolved.
+var audit struct {
+	cmd, user string
+	core      bool
+	written   bool
+}
+
+// writeAudit appends one line for this invocation with its exit status. It
+// runs once, from exit() or when main returns. Unlike history, a failure is
+// reported, since a silent gap defeats the point of an audit trail.
+func writeAudit(code int) {
+	path := os.Getenv("HVMD_AUDIT_LOG")
+	if path == "" || audit.written {
+		return
+	}
+	audit.written = true
+
+	status := "ok"
+	if code != 0 {
+		status = "failed"
+	}
+
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		fmt.Fprintf(stderr, "(!) Failed to write audit log: %v\n", err)
+		return
+	}
+	defer f.Close()
+	fmt.Fprintf(f, "%s\tuser=%s\tcmd=%s\tcore=%t\tstatus=%s\texit=%d\n",
+		time.Now().Format(time.RFC3339), audit.user, audit.cmd, audit.core, status, code)
+}
+
+func showQueryHistory(args []string) {
+	last := 20
+	if _, v, ok := popValue(args, "--last"); ok {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			fmt.Fprintln(stdout, "(!) --last expects a positive number")
+			exit(1)
+		}
+		last = n
+	}
+
+	f, err := os.Open(historyPath())
+	if err != nil {
+		if os.IsNotExist(err) {
+			fmt.Fprintln(stdout, "(!) No query history yet (enable with HVMD_HISTORY=1)")
+			return
+		}
+		fmt.Fprintf(stdout, "(X) Failed to read history: %v\n", err)
+		exit(1)
+	}
+	defer f.Close()
+
+	var lines []string
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+
+	if len(lines) > last {
+		lines = lines[len(lines)-last:]
+	}
+	for _, line := range lines {
+		ts, stmt, _ := strings.Cut(line, "\t")
+		fmt.Fprintf(output, "  (-) %s  %s\n", ts, stmt)
+	}
+}
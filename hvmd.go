@@ -1,43 +1,202 @@
 package main
 
 import (
-	"bufio"
+	"context"
 	"database/sql"
 	"fmt"
+	"net"
 	"os"
+	"path"
+	"regexp"
+	"slices"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/joho/godotenv"
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
+	"golang.org/x/term"
+)
+
+// Build metadata, set at link time:
+//
+//	go build -ldflags "-X main.version=1.2.0 -X main.commit=$(git rev-parse --short HEAD) -X main.buildDate=$(date -u +%Y-%m-%d)"
+var (
+	version   = "dev"
+	commit    = "none"
+	buildDate = "unknown"
 )
 
 var coreEnabled bool
-var sshKeyString string = ".key"
+var failOnEmpty bool
+var noWarnings bool
+var exitOnWarning bool
+var outputFmt outputFormat
+var rowCounts bool
+var warningsEmitted bool
+
+// Exit codes for scripting, distinct from the generic failure code 1.
+const (
+	// exitUnhealthy is returned by healthcheck when the database can't be
+	// reached or queried.
+	exitUnhealthy = 2
+	// exitEmpty is returned under --fail-on-empty when a command connected
+	// fine but its query produced no rows.
+	exitEmpty = 3
+	// exitWarning is returned under --exit-on-warning when the run completed
+	// but printed at least one advisory warning.
+	exitWarning = 4
+	// exitInterrupted is the conventional 128+SIGINT code after Ctrl-C.
+	exitInterrupted = 130
+)
 
 func main() {
-	// Check if --core is the LAST argument
-	coreRequested := false
-	if len(os.Args) > 1 && os.Args[len(os.Args)-1] == "--core" {
-		coreRequested = true
+	// Normal returns are successful runs; exit() records failures.
+	defer writeAudit(0)
+	defer finishPager()
+
+	// --core may appear anywhere on the command line
+	args, coreRequested := popFlag(os.Args[1:], "--core")
+	args, explainAccess := popFlag(args, "--explain-access")
+
+	args, verbose := popFlag(args, "--verbose")
+	args, traceSQL = popFlag(args, "--trace")
+	args, quiet := popFlag(args, "--quiet")
+	switch {
+	case verbose && quiet:
+		fmt.Fprintln(stdout, "(!) --verbose and --quiet cannot be used together")
+		exit(1)
+	case verbose:
+		logLevel = levelDebug
+	case quiet:
+		logLevel = levelQuiet
 	}
 
-	// Filter out --core ONLY if it's the last argument
-	var args []string
-	for i, arg := range os.Args[1:] {
-		if arg == "--core" && i == len(os.Args[1:])-1 {
-			continue
+	args, failOnEmpty = popFlag(args, "--fail-on-empty")
+	args, jsonFlag := popFlag(args, "--json")
+	args, jsonPretty = popFlag(args, "--json-pretty")
+	jsonFlag = jsonFlag || jsonPretty
+	args, formatName, hasFormat := popValue(args, "--format")
+	switch {
+	case hasFormat:
+		f, ok := parseFormat(formatName)
+		if !ok || (jsonFlag && f != formatJSON) {
+			fmt.Fprintln(stdout, "(!) --format expects table, csv or json")
+			exit(1)
 		}
-		args = append(args, arg)
+		outputFmt = f
+	case jsonFlag:
+		outputFmt = formatJSON
+	}
+	args, styleName, hasStyle := popValue(args, "--table-style")
+	if hasStyle {
+		st, ok := parseTableStyle(styleName)
+		if !ok {
+			fmt.Fprintln(stdout, "(!) --table-style expects plain, markdown or box")
+			exit(1)
+		}
+		tableStyle = st
+	}
+	args, rowCounts = popFlag(args, "--counts")
+	args, noWarnings = popFlag(args, "--no-warnings")
+	args, exitOnWarning = popFlag(args, "--exit-on-warning")
+	if os.Getenv("HVMD_STRICT") == "1" {
+		exitOnWarning = true
+	}
+
+	// The pager goes under --tee and --no-emoji so they wrap what it holds.
+	args, pagerFlag := popFlag(args, "--pager")
+	args, noPager := popFlag(args, "--no-pager")
+	if pagerFlag && noPager {
+		fmt.Fprintln(stdout, "(!) --pager and --no-pager cannot be used together")
+		exit(1)
+	}
+	if pagerFlag {
+		enablePager()
+	}
+
+	args, teePath, tee := popValue(args, "--tee")
+	if tee {
+		enableTee(teePath)
+	}
+
+	// Applied after --tee so the log file gets ASCII too.
+	args, noEmoji := popFlag(args, "--no-emoji")
+	if wantASCII(noEmoji) {
+		enableASCII()
 	}
 
-	if len(args) < 1 {
-		fmt.Println("(!) No command provided")
-		fmt.Println("    Try: hvmd help")
-		os.Exit(0)
+	output = stdout
+	args, outPath, hasOutput := popValue(args, "--output")
+	if hasOutput {
+		enableOutput(outPath, wantASCII(noEmoji))
+		// Results are in the file; what's left on screen is short.
+		disablePager()
 	}
 
-	cmd := args[0]
+	args, noColor := popFlag(args, "--no-color")
+	colorEnabled = !noColor && !hasOutput && os.Getenv("NO_COLOR") == "" && term.IsTerminal(int(os.Stdout.Fd()))
+
+	args, envFile, envFileGiven := popValue(args, "--env-file")
+	args, profileName, profileGiven := popValue(args, "--profile")
+	args, hostFlag, _ := popValue(args, "--host")
+	args, portFlag, _ := popValue(args, "--port")
+	args, userFlag, _ := popValue(args, "--user")
+	args, dbnameFlag, _ := popValue(args, "--dbname")
+	args, sslmodeFlag, _ := popValue(args, "--sslmode")
+	args, passwordStdin := popFlag(args, "--password-stdin")
+	args, passwordPrompt := popFlag(args, "--password-prompt")
+	if passwordStdin && passwordPrompt {
+		fmt.Fprintln(stdout, "(!) --password-stdin and --password-prompt cannot be used together")
+		exit(1)
+	}
+	args, retries, retryDelay := parseRetryFlags(args)
+	args, timeoutStr, hasTimeout := popValue(args, "--timeout")
+	if hasTimeout {
+		n, err := strconv.Atoi(timeoutStr)
+		if err != nil || n <= 0 {
+			fmt.Fprintln(stdout, "(!) --timeout expects a positive number of seconds")
+			exit(1)
+		}
+		queryTimeout = time.Duration(n) * time.Second
+	}
+	args, tunnelSpec, hasTunnel := popValue(args, "--tunnel")
+	args, batchPath, batch := popValue(args, "--batch")
+	args, continueOnError := popFlag(args, "--continue-on-error")
+	args, watchStr, watch := popValue(args, "--watch")
+	var watchInterval time.Duration
+	if watch {
+		n, err := strconv.Atoi(watchStr)
+		if err != nil || n <= 0 {
+			fmt.Fprintln(stdout, "(!) --watch expects a positive number of seconds")
+			exit(1)
+		}
+		if batch {
+			fmt.Fprintln(stdout, "(!) --watch and --batch cannot be used together")
+			exit(1)
+		}
+		watchInterval = time.Duration(n) * time.Second
+	}
+
+	if len(args) < 1 && !batch {
+		fmt.Fprintln(stdout, "(!) No command provided")
+		fmt.Fprintln(stdout, "    Try: hvmd help")
+		exit(0)
+	}
+
+	var cmd string
+	if len(args) > 0 {
+		cmd = args[0]
+	}
+	audit.cmd = cmd
+	if batch {
+		audit.cmd = "batch " + batchPath
+	}
+
+	// Prompting and screen-redrawing commands write straight to the terminal.
+	if watch || cmd == "shell" || cmd == "addadminsshkey" || cmd == "rotatessh" || !slices.Contains(knownCommands(true), cmd) {
+		disablePager()
+	}
 
 	// --- Normal help without --core ---
 	if cmd == "help" && !coreRequested {
@@ -45,14 +204,89 @@ func main() {
 		return
 	}
 
+	// --- Local-only commands, no DB needed ---
+	if cmd == "version" {
+		showVersion()
+		return
+	}
+	if cmd == "query-history" {
+		showQueryHistory(args[1:])
+		return
+	}
+	if cmd == "profiles" {
+		showProfiles()
+		return
+	}
+	// With --core, completion waits for the core access check below.
+	if cmd == "completion" && !coreRequested {
+		showCompletion(args[1:], false)
+		return
+	}
+
 	// --- Load .env and DB config ---
-	_ = godotenv.Load(".env") // ignore missing
+	if envFileGiven {
+		if err := godotenv.Load(envFile); err != nil {
+			fmt.Fprintf(stdout, "(X) Failed to load env file %s: %v\n", envFile, err)
+			exit(1)
+		}
+	} else {
+		_ = godotenv.Load(".env") // ignore missing
+	}
 
 	user := os.Getenv("POSTGRES_USER")
 	password := os.Getenv("POSTGRES_PASSWORD")
+	// POSTGRES_PASSWORD_FILE is only read once ping --tcp-only is ruled out.
+	passwordFile := os.Getenv("POSTGRES_PASSWORD_FILE")
 	dbname := os.Getenv("POSTGRES_DB")
 	host := os.Getenv("POSTGRES_HOST")
 	port := os.Getenv("POSTGRES_PORT")
+	sslmode := os.Getenv("POSTGRES_SSLMODE")
+	sslrootcert := os.Getenv("POSTGRES_SSLROOTCERT")
+
+	// DATABASE_URL beats the individual POSTGRES_* variables. Its pieces are
+	// still unpacked for identify, whoami and the config checks.
+	databaseURL := os.Getenv("DATABASE_URL")
+	if databaseURL != "" {
+		d, err := parseDatabaseURL(databaseURL)
+		if err != nil {
+			fmt.Fprintf(stdout, "(X) Invalid DATABASE_URL: %v\n", err)
+			exit(1)
+		}
+		user, password, host, port, dbname, sslmode = d.user, d.password, d.host, d.port, d.dbname, d.sslmode
+		passwordFile = ""
+	}
+
+	// A profile replaces the POSTGRES_* settings wholesale.
+	if profileGiven {
+		p := mustLoadProfile(profileName)
+		databaseURL = ""
+		user, password, dbname, host, port = p.User, p.Password, p.DBName, p.Host, p.Port
+		passwordFile = ""
+		if p.SSLMode != "" {
+			sslmode = p.SSLMode
+		}
+	}
+
+	// Explicit flags beat both the profile and the environment, and switch
+	// DATABASE_URL back to assembling the DSN from its pieces.
+	if hostFlag != "" || portFlag != "" || userFlag != "" || dbnameFlag != "" || sslmodeFlag != "" || passwordStdin || passwordPrompt {
+		databaseURL = ""
+	}
+	if hostFlag != "" {
+		host = hostFlag
+	}
+	if portFlag != "" {
+		port = portFlag
+	}
+	if userFlag != "" {
+		user = userFlag
+	}
+	if dbnameFlag != "" {
+		dbname = dbnameFlag
+	}
+	if sslmodeFlag != "" {
+		sslmode = sslmodeFlag
+	}
 
 	if host == "" {
 		host = "localhost"
@@ -60,47 +294,150 @@ func main() {
 	if port == "" {
 		port = "5432"
 	}
+	if sslmode == "" {
+		sslmode = "disable"
+	}
+	if !isValidSSLMode(sslmode) {
+		fmt.Fprintf(stdout, "(X) Invalid sslmode %q\n", sslmode)
+		fmt.Fprintf(stdout, "    Valid options: %s\n", strings.Join(sslModes, ", "))
+		exit(1)
+	}
+
+	// --- Network reachability only, no credentials needed ---
+	if cmd == "ping" {
+		if _, tcpOnly := popFlag(args[1:], "--tcp-only"); tcpOnly {
+			if isSocketHost(host) {
+				fmt.Fprintf(stdout, "(!) --tcp-only needs a TCP host, %s is a Unix socket\n", host)
+				exit(1)
+			}
+			showTCPPing(host, port)
+			return
+		}
+	}
+
+	if passwordFile != "" {
+		p, err := readPasswordFile(passwordFile)
+		if err != nil {
+			fmt.Fprintf(stdout, "(X) Failed to read POSTGRES_PASSWORD_FILE: %v\n", err)
+			exit(1)
+		}
+		password = p
+	}
+	if passwordStdin {
+		p, err := readPasswordStdin()
+		if err != nil {
+			fmt.Fprintf(stdout, "(X) Failed to read password from stdin: %v\n", err)
+			exit(1)
+		}
+		password = p
+	}
+	if passwordPrompt {
+		p, err := promptPassword(user)
+		if err != nil {
+			fmt.Fprintf(stdout, "(X) %v\n", err)
+			exit(1)
+		}
+		password = p
+	}
+
+	if password == "" {
+		password = os.Getenv("PGPASSWORD")
+	}
+
+	timeout := connectTimeout()
+	appName := applicationName(cmd)
+	connStr := buildDSN(user, password, host, port, dbname, sslmode, sslrootcert, appName, timeout)
+	if databaseURL != "" {
+		connStr = urlDSN(databaseURL, appName, timeout)
+	}
+
+	setPluginEnv(host, port, user, password, dbname, sslmode, connStr)
+	audit.user = user
+
+	// --- Resolved settings only, nothing is dialled ---
+	if cmd == "connstring" {
+		fmt.Fprintln(output, maskDSN(connStr))
+		return
+	}
+
+	// --- Monitoring probe, owns its output and exit codes ---
+	if cmd == "healthcheck" {
+		runHealthcheck(connStr, timeout, user != "" && password != "" && dbname != "")
+		return
+	}
 
 	if user == "" || password == "" || dbname == "" {
 		// If core was requested, fail immediately
 		if coreRequested {
-			fmt.Println("(!) Unknown command: --core")
-			fmt.Println("    Try: hvmd help")
-			os.Exit(1)
+			fmt.Fprintln(stdout, "(!) Unknown command: --core")
+			fmt.Fprintln(stdout, "    Try: hvmd help")
+			exit(1)
 		}
-		fmt.Println("(X) Failed to connect to the VOID. Forcefield active.")
-		os.Exit(1)
+		reportMissingConfig(user, password, dbname)
+		exit(1)
 	}
 
-	connStr := fmt.Sprintf("postgres://%s:%s@%s:%s/%s?sslmode=disable",
-		user, password, host, port, dbname)
+	// --- Optional SSH tunnel through a bastion ---
+	var dialer pq.Dialer
+	if hasTunnel {
+		tunnel, err := openTunnel(tunnelSpec)
+		if err != nil {
+			fmt.Fprintf(stdout, "(X) SSH tunnel to %s failed: %v\n", tunnelSpec, err)
+			exit(1)
+		}
+		defer tunnel.Close()
+		debugf("tunnelling through %s", tunnelSpec)
+		dialer = sshDialer{tunnel}
+	}
 
-	db, err := sql.Open("postgres", connStr)
+	debugf("connecting to %s:%s/%s as %s (sslmode=%s, timeout=%s)", host, port, dbname, user, sslmode, timeout)
+	db, err := openDB(connStr, dialer)
 	if err != nil {
 		if coreRequested {
-			fmt.Println("(!) Unknown command: --core")
-			fmt.Println("    Try: hvmd help")
-			os.Exit(1)
+			fmt.Fprintln(stdout, "(!) Unknown command: --core")
+			fmt.Fprintln(stdout, "    Try: hvmd help")
+			exit(1)
 		}
-		fmt.Println("(X) Failed to connect to the VOID. Forcefield active.")
-		os.Exit(1)
+		fmt.Fprintln(stdout, "(X) Failed to connect to the VOID. Forcefield active.")
+		exit(1)
 	}
 	defer db.Close()
+	configurePool(db)
+	if !watch {
+		handleInterrupt(db)
+	}
 
-	if err := db.Ping(); err != nil {
+	start := time.Now()
+	if err := pingWithRetry(db, timeout, retries, retryDelay); err != nil {
 		if coreRequested {
-			fmt.Println("(!) Unknown command: --core")
-			fmt.Println("    Try: hvmd help")
-			os.Exit(1)
+			fmt.Fprintln(stdout, "(!) Unknown command: --core")
+			fmt.Fprintln(stdout, "    Try: hvmd help")
+			exit(1)
+		}
+		reportConnError(err, timeout)
+		exit(1)
+	}
+
+	debugf("connected in %s", time.Since(start).Round(time.Millisecond))
+	if logLevel >= levelDebug {
+		var isSuper bool
+		if err := db.QueryRow("SELECT rolsuper FROM pg_roles WHERE rolname = current_user;").Scan(&isSuper); err == nil {
+			warnIfSuperuser(isSuper)
 		}
-		fmt.Println("(X) Failed to connect to the VOID. Forcefield active.")
-		os.Exit(1)
 	}
 
 	// --- Check core access if --core was requested ---
+	if explainAccess {
+		if access := coreAccessReason(db, user); access.allowed {
+			fmt.Fprintf(stdout, "(✓) Core access granted: %s\n", access.reason)
+		} else {
+			fmt.Fprintf(stdout, "(!) Core access denied: %s\n", access.reason)
+		}
+	}
 	if coreRequested {
 		if checkCoreAccess(db, user) {
 			coreEnabled = true
+			audit.core = true
 			checkSSHConnection(db)
 
 			// If the command is help, now show core help
@@ -109,243 +446,586 @@ func main() {
 				return
 			}
 		} else {
-			fmt.Println("(!) Unknown command: --core")
-			fmt.Println("    Try: hvmd help")
-			os.Exit(1)
+			fmt.Fprintln(stdout, "(!) Unknown command: --core")
+			fmt.Fprintln(stdout, "    Try: hvmd help")
+			exit(1)
 		}
 	}
 
-	// --- Execute other commands ---
+	// --- Run a runbook over this single connection ---
+	if batch {
+		runBatch(batchPath, continueOnError, coreRequested, db, user)
+	} else if watch {
+		if cmd == "shell" {
+			fmt.Fprintln(stdout, "(!) --watch cannot be used with shell")
+			exit(1)
+		}
+		runWatch(watchInterval, args, func() { dispatch(cmd, args[1:], db, user) })
+	} else {
+		// --- Execute other commands ---
+		dispatch(cmd, args[1:], db, user)
+	}
+
+	reportOutput()
+
+	if exitOnWarning && warningsEmitted {
+		exit(exitWarning)
+	}
+}
+
+// dispatch runs a single command against an open connection. It is shared by
+// main and the batch runner.
+func dispatch(cmd string, args []string, db *sql.DB, user string) {
 	switch cmd {
+	case "help":
+		showHelp(coreEnabled)
+	case "version":
+		showVersion()
+	case "query-history":
+		showQueryHistory(args)
 	case "ping":
-		showPing(db)
+		showPing(db, args)
 	case "admins":
-		showAdmins(db)
+		showAdmins(db, args, outputFmt)
+	case "users":
+		showUsers(db, args, outputFmt)
+	case "databases":
+		showDatabases(db, args)
+	case "extensions":
+		showExtensions(db)
+	case "doctor":
+		runDoctor(db)
+	case "encoding-check":
+		runEncodingCheck(db)
+	case "functions":
+		showFunctions(db, args)
+	case "views":
+		showViews(db, args)
+	case "whoami":
+		showWhoami(db, user)
+	case "tables":
+		showTables(db, args)
+	case "describe":
+		runDescribe(db, args)
+	case "shell":
+		runShell(db, user)
+	case "completion":
+		showCompletion(args, coreEnabled)
 	case "identify":
 		if !coreEnabled {
-			fmt.Println("(!) Unknown command:", cmd)
+			fmt.Fprintln(stdout, "(!) Unknown command:", cmd)
 			suggestSimilar(cmd)
-			os.Exit(1)
+			exit(1)
 		}
 		showIdentify(db, user)
 	case "addadminsshkey":
-		addAdminSSHKey()
+		addAdminSSHKey(args)
 	case "catssh":
 		catSSH()
+	case "rotatessh":
+		rotateSSH()
 	case "readdb":
 		if coreEnabled {
-			runReadDB(db)
+			runReadDB(db, args, outputFmt)
 		} else {
-			runReadDBBasic(db)
+			runReadDBBasic(db, args, outputFmt)
 		}
 	default:
 		if isCoreCommand(cmd) && !coreEnabled {
-			fmt.Println("(!) Unknown command:", cmd)
+			fmt.Fprintln(stdout, "(!) Unknown command:", cmd)
 			suggestSimilar(cmd)
-			os.Exit(1)
+			exit(1)
 		} else if isCoreCommand(cmd) && coreEnabled {
-			handleCoreCommand(cmd, db)
+			handleCoreCommand(cmd, args, db, user)
+		} else if runPlugin(cmd, args) {
+			// handled by an hvmd-<cmd> executable on PATH
 		} else {
-			fmt.Println("(!) Unknown command:", cmd)
+			fmt.Fprintln(stdout, "(!) Unknown command:", cmd)
 			suggestSimilar(cmd)
-			os.Exit(1)
+			exit(1)
 		}
 	}
 }
 
 // --- Core-only SSH functions ---
 func checkSSHConnection(db *sql.DB) {
-	// --- Check for .key file ---
-	keyEnv, err := godotenv.Read(sshKeyString)
+	// --- Check for the key file ---
+	path := keyFilePath()
+	keyEnv, err := readKeyFile(path)
+	if err == errBadPassphrase {
+		fmt.Fprintf(stdout, "(X) Wrong passphrase or corrupted %s. Forcefield active.\n", path)
+		exit(1)
+	}
 	if err != nil {
-		fmt.Println("(X) Failed to read .key file. Forcefield active.")
-		os.Exit(1)
+		fmt.Fprintf(stdout, "(X) Failed to read %s. Forcefield active.\n", path)
+		exit(1)
 	}
 
 	sshKey := keyEnv["SSH_KEY"]
 	if sshKey == "" {
-		fmt.Println("(X) No .key file found. Forcefield active.")
-		os.Exit(1)
+		fmt.Fprintf(stdout, "(X) No SSH key in %s. Forcefield active.\n", path)
+		exit(1)
 	}
 
-	fmt.Println("{🏷️  } SSH key loaded from .key")
+	if outputFmt == formatTable {
+		infof("{🏷️  } SSH key loaded from %s", path)
+	}
 
 	// --- Test DB connection silently ---
 	var now string
 	if err := db.QueryRow("SELECT NOW();").Scan(&now); err != nil {
-		fmt.Println("(X) Failed to connect to the VOID. Forcefield active.")
-		os.Exit(1)
+		fmt.Fprintln(stdout, "(X) Failed to connect to the VOID. Forcefield active.")
+		exit(1)
 	}
 
 	// Optional: Uncomment if you want a success message
-	// fmt.Printf("{🔗 } Database connection OK. Current time: %s\n", now)
+	// fmt.Fprintf(stdout, "{🔗 } Database connection OK. Current time: %s\n", now)
 }
 
-func addAdminSSHKey() {
-	reader := bufio.NewReader(os.Stdin)
+func addAdminSSHKey(args []string) {
+	_, force := popFlag(args, "--force")
+	path := keyFilePath()
+
+	if _, err := os.Stat(path); err == nil && !force {
+		if !confirmKeyOverwrite(path) {
+			fmt.Fprintf(stdout, "(!) Keeping the existing %s\n", path)
+			return
+		}
+	}
+
+	sshKey, ok := promptSSHKey()
+	if !ok {
+		exit(1)
+	}
+
+	err := writeKeyFile(path, map[string]string{"SSH_KEY": sshKey})
+	if err != nil {
+		fmt.Fprintf(stdout, "{⚠️   } Failed to write %s: %v\n", path, err)
+		exit(1)
+	}
+
+	fmt.Fprintf(stdout, "{📝 } SSH key encrypted and written to %s\n", path)
+}
 
-	fmt.Println("Paste your SSH public key (press Enter when done):")
-	sshKey, err := reader.ReadString('\n')
+// promptSSHKey reads a public key from stdin and checks its format, saying
+// why when it is rejected.
+func promptSSHKey() (string, bool) {
+	fmt.Fprintln(stdout, "Paste your SSH public key (press Enter when done):")
+	sshKey, err := stdinReader.ReadString('\n')
 	if err != nil {
-		fmt.Printf("{⚠️   } Failed to read input: %v\n", err)
-		os.Exit(1)
+		fmt.Fprintf(stdout, "{⚠️   } Failed to read input: %v\n", err)
+		return "", false
 	}
 
 	sshKey = strings.TrimSpace(sshKey)
 
 	if sshKey == "" {
-		fmt.Println("(X) No key provided")
-		os.Exit(1)
+		fmt.Fprintln(stdout, "(X) No key provided")
+		return "", false
 	}
 
-	content := fmt.Sprintf("SSH_KEY=%s\n", sshKey)
-	err = os.WriteFile(".key", []byte(content), 0600)
+	if strings.Contains(sshKey, "PRIVATE KEY") {
+		fmt.Fprintln(stdout, "{⚠️   } That looks like a PRIVATE key. Paste the public key (the .pub file) instead.")
+		return "", false
+	}
+	if err := checkPublicKey(sshKey); err != nil {
+		fmt.Fprintf(stdout, "(X) Not a valid OpenSSH public key: %v\n", err)
+		fmt.Fprintln(stdout, "    Expected one line like: ssh-ed25519 AAAA... user@host")
+		return "", false
+	}
+	return sshKey, true
+}
+
+// rotateSSH replaces the stored key, keeping the old file as a timestamped
+// backup. If the new key can't be written the backup is put back.
+func rotateSSH() {
+	path := keyFilePath()
+	old, err := os.ReadFile(path)
 	if err != nil {
-		fmt.Printf("{⚠️   } Failed to write .key file: %v\n", err)
-		os.Exit(1)
+		fmt.Fprintf(stdout, "(X) No %s to rotate. Use: hvmd addadminsshkey\n", path)
+		exit(1)
+	}
+
+	backup := fmt.Sprintf("%s.bak.%d", path, time.Now().Unix())
+	if err := os.WriteFile(backup, old, 0600); err != nil {
+		fmt.Fprintf(stdout, "{⚠️   } Failed to write backup %s: %v\n", backup, err)
+		exit(1)
 	}
+	fmt.Fprintf(stdout, "{💾 } Current key backed up to %s\n", backup)
 
-	fmt.Println("{📝 } SSH key successfully written to .key")
+	sshKey, ok := promptSSHKey()
+	if !ok {
+		fmt.Fprintf(stdout, "    %s left unchanged\n", path)
+		exit(1)
+	}
+
+	if err := writeKeyFile(path, map[string]string{"SSH_KEY": sshKey}); err != nil {
+		fmt.Fprintf(stdout, "{⚠️   } Failed to write %s: %v\n", path, err)
+		if rerr := os.WriteFile(path, old, 0600); rerr != nil {
+			fmt.Fprintf(stdout, "(X) Failed to restore %s, recover it from %s: %v\n", path, backup, rerr)
+		} else {
+			fmt.Fprintf(stdout, "    Restored the previous key from %s\n", backup)
+		}
+		exit(1)
+	}
+
+	fmt.Fprintf(stdout, "{📝 } SSH key rotated, new key encrypted and written to %s\n", path)
+}
+
+// confirmKeyOverwrite shows a preview of the key stored in path and asks
+// whether to replace it.
+func confirmKeyOverwrite(path string) bool {
+	fmt.Fprintf(stdout, "{⚠️   } %s already exists\n", path)
+	keyEnv, err := readKeyFile(path)
+	if err != nil {
+		fmt.Fprintf(stdout, "    Current key could not be read: %v\n", err)
+	} else {
+		fmt.Fprintf(stdout, "    Current key: %s\n", previewKey(keyEnv["SSH_KEY"]))
+	}
+
+	fmt.Fprint(stdout, "Overwrite it? [y/N]: ")
+	answer, _ := stdinReader.ReadString('\n')
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
+
+// previewKey shows just enough of a key to recognise it.
+func previewKey(key string) string {
+	if len(key) <= 24 {
+		return key
+	}
+	return key[:16] + "..." + key[len(key)-8:]
 }
 
 func catSSH() {
-	keyEnv, err := godotenv.Read(".key")
+	path := keyFilePath()
+	keyEnv, err := readKeyFile(path)
+	if err == errBadPassphrase {
+		fmt.Fprintf(stdout, "{⚠️   } Wrong passphrase or corrupted %s\n", path)
+		exit(1)
+	}
 	if err != nil {
-		fmt.Printf("{⚠️   } Failed to read .key file: %v\n", err)
-		os.Exit(1)
+		fmt.Fprintf(stdout, "{⚠️   } Failed to read %s: %v\n", path, err)
+		exit(1)
 	}
 
 	sshKey := keyEnv["SSH_KEY"]
 	if sshKey == "" {
-		fmt.Println("{⚠️   } No SSH_KEY found in .key file")
+		fmt.Fprintf(stdout, "{⚠️   } No SSH_KEY found in %s\n", path)
 		return
 	}
 
-	fmt.Println(sshKey)
+	fmt.Fprintln(stdout, sshKey)
 }
 
 func runTestSSH() {
-	keyEnv, err := godotenv.Read(sshKeyString)
+	path := keyFilePath()
+	keyEnv, err := readKeyFile(path)
+	if err == errBadPassphrase {
+		fmt.Fprintf(stdout, "{⚠️   } Wrong passphrase or corrupted %s\n", path)
+		return
+	}
 	if err != nil {
-		fmt.Printf("{⚠️   } Failed to read %s: %v\n", sshKeyString, err)
+		fmt.Fprintf(stdout, "{⚠️   } Failed to read %s: %v\n", path, err)
 		return
 	}
 
 	sshKey := keyEnv["SSH_KEY"]
 	if sshKey == "" {
-		fmt.Println("{⚠️   } No SSH_KEY found, cannot test SSH")
+		fmt.Fprintln(stdout, "{⚠️   } No SSH_KEY found, cannot test SSH")
+		return
+	}
+
+	sshUser, addr, err := sshTarget(keyEnv)
+	if err != nil {
+		fmt.Fprintf(stdout, "{⚠️   } %v\n", err)
 		return
 	}
 
-	fmt.Println("{🔑 } SSH key loaded, running test connection...")
-	time.Sleep(1 * time.Second)
-	fmt.Println("{🔗 } SSH connection test successful!")
+	fmt.Fprintf(stdout, "{🔑 } SSH key loaded, connecting to %s@%s...\n", sshUser, addr)
+	client, err := dialSSH(keyEnv, sshUser, addr)
+	if err != nil {
+		fmt.Fprintf(stdout, "{⚠️   } SSH connection failed: %v\n", err)
+		exit(1)
+	}
+	defer client.Close()
+
+	session, err := client.NewSession()
+	if err != nil {
+		fmt.Fprintf(stdout, "{⚠️   } Failed to open SSH session: %v\n", err)
+		exit(1)
+	}
+	defer session.Close()
+
+	out, err := session.CombinedOutput("echo hvmd-ok")
+	if err != nil || strings.TrimSpace(string(out)) != "hvmd-ok" {
+		fmt.Fprintf(stdout, "{⚠️   } Remote command failed: %v %s\n", err, strings.TrimSpace(string(out)))
+		exit(1)
+	}
+	fmt.Fprintln(stdout, "{🔗 } SSH connection test successful!")
 }
 
 // --- Core access check ---
+
+// coreDecision is the outcome of a core access check and why it came out
+// that way, as printed by --explain-access.
+type coreDecision struct {
+	allowed bool
+	reason  string
+}
+
+// coreAccess memoizes coreAccessReason per role for the life of the process;
+// grant-core and revoke-core clear it.
+var coreAccess = map[string]coreDecision{}
+
+func invalidateCoreAccess() {
+	clear(coreAccess)
+}
+
 func checkCoreAccess(db *sql.DB, username string) bool {
+	return coreAccessReason(db, username).allowed
+}
+
+// coreAccessReason decides whether username may use core commands. Query
+// errors are not memoized so a later check can still succeed.
+func coreAccessReason(db *sql.DB, username string) coreDecision {
+	if d, ok := coreAccess[username]; ok {
+		return d
+	}
+
 	var isSuperuser bool
 	err := db.QueryRow(`
 		SELECT rolsuper 
-		FROM pg_roles 
+		FROM pg_catalog.pg_roles 
 		WHERE rolname = $1
 	`, username).Scan(&isSuperuser)
 
+	if err == sql.ErrNoRows {
+		d := coreDecision{reason: fmt.Sprintf("role %q not found", username)}
+		coreAccess[username] = d
+		return d
+	}
 	if err != nil {
-		return false
+		return coreDecision{reason: fmt.Sprintf("role lookup failed: %v", err)}
+	}
+	if isSuperuser {
+		d := coreDecision{allowed: true, reason: fmt.Sprintf("%s is a superuser", username)}
+		coreAccess[username] = d
+		return d
 	}
 
-	return isSuperuser
-}
-
-func isCoreCommand(cmd string) bool {
-	coreCommands := []string{"identify", "testssh", "readdb"}
-	for _, c := range coreCommands {
-		if c == cmd {
-			return true
+	// Delegated core access; a missing allowlist simply means no delegations
+	// have been made yet. One not owned by a superuser is never trusted.
+	exists, trusted, err := coreAllowlistState(db)
+	if err != nil {
+		return coreDecision{reason: fmt.Sprintf("allowlist check failed: %v", err)}
+	}
+	var d coreDecision
+	switch {
+	case !exists:
+		d.reason = fmt.Sprintf("%s is not a superuser and no core allowlist exists", username)
+	case !trusted:
+		d.reason = fmt.Sprintf("%s is not a superuser and %s is not owned by a superuser, so it is ignored", username, coreUsersTable)
+	default:
+		var allowed bool
+		err = db.QueryRow(`
+			SELECT EXISTS (SELECT 1 FROM `+coreUsersTable+` WHERE rolname = $1)
+		`, username).Scan(&allowed)
+		switch {
+		case err != nil:
+			return coreDecision{reason: fmt.Sprintf("allowlist lookup failed: %v", err)}
+		case allowed:
+			d = coreDecision{allowed: true, reason: fmt.Sprintf("%s is in the %s allowlist", username, coreUsersTable)}
+		default:
+			d.reason = fmt.Sprintf("%s is not a superuser and not in the %s allowlist", username, coreUsersTable)
 		}
 	}
-	return false
+	coreAccess[username] = d
+	return d
 }
 
-func handleCoreCommand(cmd string, db *sql.DB) {
-	fmt.Printf("{🌐 } Executing: %s\n", strings.ToUpper(cmd))
+func handleCoreCommand(cmd string, args []string, db *sql.DB, user string) {
+	if outputFmt == formatTable {
+		infof("{🌐 } Executing: %s", strings.ToUpper(cmd))
+	}
 
 	switch cmd {
 	case "testssh":
 		runTestSSH()
 	case "readdb":
-		runReadDB(db)
+		runReadDB(db, args, outputFmt)
+	case "missing-fk-indexes":
+		runMissingFKIndexes(db, args)
+	case "export-roles":
+		runExportRoles(db, args, user)
+	case "set-connlimit":
+		runSetConnLimit(db, args)
+	case "backup-roles":
+		runBackupRoles(db, args)
+	case "no-primary-key":
+		runNoPrimaryKey(db, args)
+	case "query":
+		runQuery(db, args, outputFmt)
+	case "export-schema":
+		runExportSchema(db, args)
+	case "grant-core":
+		runGrantCore(db, args)
+	case "revoke-core":
+		runRevokeCore(db, args)
+	case "core-users":
+		showCoreUsers(db)
+	case "sizes":
+		showSizes(db)
+	case "sequences":
+		showSequences(db)
+	case "grants":
+		showGrants(db, args)
+	case "vacuum-status":
+		runVacuumStatus(db, args)
+	case "peek":
+		runPeek(db, args)
+	case "dump":
+		runDump(db, args)
+	case "schema-diff":
+		runSchemaDiff(args)
+	case "test-write":
+		runTestWrite(db)
+	case "roles-tree":
+		showRolesTree(db)
+	case "settings":
+		showSettings(db, args)
+	case "activity":
+		runActivity(db, args, outputFmt)
+	case "locks":
+		runLocks(db, args)
+	case "kill":
+		runSignalBackend(db, args, true)
+	case "cancel":
+		runSignalBackend(db, args, false)
+	case "kill-idle":
+		runKillIdle(db, args)
+	case "audit-superusers":
+		runAuditSuperusers(db)
 	default:
-		fmt.Println("{👁️  } Core command not yet implemented")
+		fmt.Fprintln(stdout, "{👁️  } Core command not yet implemented")
 	}
 }
 
-// --- Database reads ---
-func runReadDB(db *sql.DB) {
-	fmt.Println("{📚 } Reading database schema...")
+// --- Table name filters ---
 
-	rows, err := db.Query(`
-        SELECT table_name
-        FROM information_schema.tables
-        WHERE table_schema='public'
-        ORDER BY table_name;
-    `)
+// singleTableMatch handles readdb's optional <table> argument. A named table
+// must exist in the public schema and replaces any filter; with no argument
+// match is returned unchanged.
+func singleTableMatch(db *sql.DB, args []string, match func(string) bool) (func(string) bool, bool) {
+	if len(args) == 0 {
+		return match, false
+	}
+	if len(args) > 1 {
+		fmt.Fprintln(stdout, "(!) Usage: hvmd readdb [table]")
+		exit(1)
+	}
+
+	table := args[0]
+	tables, err := listTables(db, func(string) bool { return true })
 	if err != nil {
-		fmt.Printf("{⚠️  } Failed to fetch tables: %v\n", err)
-		return
+		fmt.Fprintf(stdout, "(!) Failed to fetch tables: %s\n", describeQueryErr(err))
+		exit(1)
 	}
-	defer rows.Close()
+	if !slices.Contains(tables, table) {
+		fmt.Fprintf(stdout, "(!) No such table: %s\n", table)
+		exit(1)
+	}
+	return func(name string) bool { return name == table }, true
+}
 
-	tables := []string{}
-	for rows.Next() {
-		var table string
-		if err := rows.Scan(&table); err != nil {
-			fmt.Printf("{⚠️  } Failed to read table: %v\n", err)
-			continue
+// parseTableFilter consumes --table-filter=<glob> or --table-regex=<pattern>
+// from args and returns a matcher for table names. With neither flag every
+// table matches.
+func parseTableFilter(args []string) ([]string, func(string) bool) {
+	args, glob, hasGlob := popValue(args, "--table-filter")
+	args, pattern, hasRegex := popValue(args, "--table-regex")
+
+	switch {
+	case hasGlob && hasRegex:
+		fmt.Fprintln(stdout, "(!) --table-filter and --table-regex cannot be used together")
+		exit(1)
+	case hasGlob:
+		if _, err := path.Match(glob, ""); err != nil {
+			fmt.Fprintf(stdout, "(!) Invalid --table-filter %q: %v\n", glob, err)
+			exit(1)
+		}
+		return args, func(name string) bool {
+			ok, _ := path.Match(glob, name)
+			return ok
 		}
-		tables = append(tables, table)
+	case hasRegex:
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			fmt.Fprintf(stdout, "(!) Invalid --table-regex %q: %v\n", pattern, err)
+			exit(1)
+		}
+		return args, re.MatchString
+	}
+	return args, func(string) bool { return true }
+}
+
+// --- Database reads ---
+func runReadDB(db *sql.DB, args []string, f outputFormat) {
+	args, match := parseTableFilter(args)
+	match, single := singleTableMatch(db, args, match)
+
+	if f != formatTable {
+		emitSchema(db, match, !single, f)
+		return
+	}
+
+	infof("{📚 } Reading database schema...")
+
+	tables, err := listTables(db, match)
+	if err != nil {
+		fmt.Fprintf(stdout, "{⚠️  } Failed to fetch tables: %s\n", describeQueryErr(err))
+		return
 	}
 
 	if len(tables) == 0 {
-		fmt.Println("{⚠️  } No tables found")
+		fmt.Fprintln(stdout, "{⚠️  } No tables found")
+		exitIfEmpty()
 		return
 	}
 
 	for _, table := range tables {
-		fmt.Printf("\n{🗃️  } Table: %s\n", table)
-
-		colRows, err := db.Query(`
-            SELECT column_name, data_type, is_nullable
-            FROM information_schema.columns
-            WHERE table_name = $1
-            ORDER BY ordinal_position;
-        `, table)
-		if err != nil {
-			fmt.Printf("{⚠️  } Failed to read columns for %s: %v\n", table, err)
+		err := printTableDetail(db, table)
+		if err == nil {
 			continue
 		}
-
-		for colRows.Next() {
-			var colName, dataType, isNullable string
-			if err := colRows.Scan(&colName, &dataType, &isNullable); err != nil {
-				fmt.Printf("{⚠️  } Failed to read column: %v\n", err)
-				continue
-			}
-			fmt.Printf("    📝  %s | %s | nullable: %s\n", colName, dataType, isNullable)
+		// One reconnect and retry per table; a second loss ends the dump
+		// instead of failing every remaining table the same way.
+		fmt.Fprintf(stdout, "{⚠️  } Connection lost while reading %s: %v\n", table, err)
+		if err := reconnect(db); err != nil {
+			fmt.Fprintf(stdout, "{⚠️  } Reconnect failed, giving up: %v\n", err)
+			exit(1)
 		}
-		colRows.Close()
+		fmt.Fprintf(stdout, "{🔗 } Reconnected, retrying %s\n", table)
+		if err := printTableDetail(db, table); err != nil {
+			fmt.Fprintf(stdout, "{⚠️  } Connection lost again, giving up: %v\n", err)
+			exit(1)
+		}
+	}
+	if single {
+		return
 	}
 
-	fmt.Println("\n{🔒 } Admin Users:")
-	adminRows, err := db.Query(`
+	fmt.Fprintln(output, "\n{🔒 } Admin Users:")
+	ctx, cancel := queryContext()
+	defer cancel()
+	adminRows, err := db.QueryContext(ctx, `
         SELECT rolname 
         FROM pg_roles 
         WHERE rolsuper = true OR rolcreaterole = true
         ORDER BY rolname;
     `)
 	if err != nil {
-		fmt.Printf("{⚠️  } Failed to read admin users: %v\n", err)
+		fmt.Fprintf(stdout, "{⚠️  } Failed to read admin users: %s\n", describeQueryErr(err))
 		return
 	}
 	defer adminRows.Close()
@@ -355,22 +1035,23 @@ func runReadDB(db *sql.DB) {
 		if err := adminRows.Scan(&a); err != nil {
 			continue
 		}
-		fmt.Printf("    🔑  %s\n", a)
+		fmt.Fprintf(output, "    🔑  %s\n", a)
 	}
 }
 
-func runReadDBBasic(db *sql.DB) {
-	fmt.Println("(>) Reading database tables")
+// listTables returns the public table names accepted by match.
+func listTables(db *sql.DB, match func(string) bool) ([]string, error) {
+	ctx, cancel := queryContext()
+	defer cancel()
 
-	rows, err := db.Query(`
+	rows, err := db.QueryContext(ctx, `
         SELECT table_name
         FROM information_schema.tables
         WHERE table_schema='public'
         ORDER BY table_name;
     `)
 	if err != nil {
-		fmt.Printf("(!) Failed to fetch tables: %v\n", err)
-		return
+		return nil, err
 	}
 	defer rows.Close()
 
@@ -378,54 +1059,308 @@ func runReadDBBasic(db *sql.DB) {
 	for rows.Next() {
 		var table string
 		if err := rows.Scan(&table); err != nil {
-			fmt.Printf("(!) Failed to read table: %v\n", err)
+			return nil, err
+		}
+		if match(table) {
+			tables = append(tables, table)
+		}
+	}
+	return tables, rows.Err()
+}
+
+// printTableDetail prints the core view of one table. Its queries share one
+// --timeout budget, so a slow table is skipped rather than stalling the dump.
+// Row-level problems are reported and skipped; a lost connection stops the
+// table and is returned so the caller can reconnect.
+func printTableDetail(db *sql.DB, table string) error {
+	ctx, cancel := queryContext()
+	defer cancel()
+
+	fmt.Fprintf(output, "\n{🗃️  } Table: %s\n", table)
+
+	pkCols, err := primaryKeyColumns(ctx, db, table)
+	if isConnError(err) {
+		return err
+	}
+	if err != nil {
+		fmt.Fprintf(stdout, "{⚠️  } Failed to read primary key for %s: %s\n", table, describeQueryErr(err))
+		if isQueryTimeout(err) {
+			return nil
+		}
+	}
+
+	queryStart := time.Now()
+	colRows, err := db.QueryContext(ctx, `
+            SELECT column_name, data_type, is_nullable
+            FROM information_schema.columns
+            WHERE table_name = $1
+            ORDER BY ordinal_position;
+        `, table)
+	if isConnError(err) {
+		return err
+	}
+	if err != nil {
+		fmt.Fprintf(stdout, "{⚠️  } Failed to read columns for %s: %s\n", table, describeQueryErr(err))
+		return nil
+	}
+
+	for colRows.Next() {
+		var colName, dataType, isNullable string
+		if err := colRows.Scan(&colName, &dataType, &isNullable); err != nil {
+			fmt.Fprintf(stdout, "{⚠️  } Failed to read column: %v\n", err)
 			continue
 		}
-		tables = append(tables, table)
+		marker, color := "📝", colorNotNull
+		if isNullable == "YES" {
+			color = colorNullable
+		}
+		if pkCols[colName] {
+			marker, color = "🔑", colorKey
+		}
+		fmt.Fprintf(output, "    %s  %s | %s | nullable: %s\n", marker, paint(color, colName), dataType, isNullable)
+	}
+	if err := colRows.Err(); isConnError(err) {
+		colRows.Close()
+		return err
+	} else if err != nil {
+		fmt.Fprintf(stdout, "{⚠️  } Failed to read columns for %s: %s\n", table, describeQueryErr(err))
+	}
+	colRows.Close()
+	debugf("columns of %s read in %s", table, time.Since(queryStart).Round(time.Microsecond))
+
+	idxs, err := tableIndexes(ctx, db, table)
+	if isConnError(err) {
+		return err
+	}
+	if err != nil {
+		fmt.Fprintf(stdout, "{⚠️  } Failed to read indexes for %s: %s\n", table, describeQueryErr(err))
+	}
+	for _, idx := range idxs {
+		marker := "📇"
+		if idx.unique {
+			marker = "💎"
+		}
+		fmt.Fprintf(output, "    %s  %s: %s\n", marker, idx.name, idx.def)
+	}
+
+	fks, err := foreignKeys(ctx, db, table)
+	if isConnError(err) {
+		return err
+	}
+	if err != nil {
+		fmt.Fprintf(stdout, "{⚠️  } Failed to read foreign keys for %s: %s\n", table, describeQueryErr(err))
+	}
+	for _, fk := range fks {
+		fmt.Fprintf(output, "    🔗  %s -> %s.%s\n", fk.column, fk.refTable, fk.refColumn)
+	}
+
+	if rowCounts {
+		fmt.Fprintf(output, "    rows: %s\n", countRows(ctx, db, table))
+	}
+	return nil
+}
+
+func showTables(db *sql.DB, args []string) {
+	_, match := parseTableFilter(args)
+
+	tables, err := listTables(db, match)
+	if err != nil {
+		fmt.Fprintf(stdout, "(X) Failed to fetch tables: %s\n", describeQueryErr(err))
+		exit(1)
+	}
+
+	if len(tables) == 0 {
+		fmt.Fprintln(stdout, "(!) No tables found")
+		exitIfEmpty()
+		return
+	}
+	for _, table := range tables {
+		fmt.Fprintln(output, table)
+	}
+	fmt.Fprintf(output, "(✓) %d table(s)\n", len(tables))
+}
+
+// countRows returns the exact row count of a public table, or "unavailable"
+// when it can't be counted (permissions, locks, ...).
+func countRows(ctx context.Context, db *sql.DB, table string) string {
+	var n int64
+	query := fmt.Sprintf("SELECT COUNT(*) FROM %s.%s;", pq.QuoteIdentifier("public"), pq.QuoteIdentifier(table))
+	if err := db.QueryRowContext(ctx, query).Scan(&n); err != nil {
+		if isQueryTimeout(err) {
+			return "unavailable (query exceeded timeout)"
+		}
+		return "unavailable"
+	}
+	return strconv.FormatInt(n, 10)
+}
+
+func runReadDBBasic(db *sql.DB, args []string, f outputFormat) {
+	args, match := parseTableFilter(args)
+	match, _ = singleTableMatch(db, args, match)
+
+	if f != formatTable {
+		emitSchema(db, match, false, f)
+		return
+	}
+
+	infof("(>) Reading database tables")
+
+	tables, err := listTables(db, match)
+	if err != nil {
+		fmt.Fprintf(stdout, "(!) Failed to fetch tables: %s\n", describeQueryErr(err))
+		return
 	}
 
 	if len(tables) == 0 {
-		fmt.Println("(!) No tables found")
+		fmt.Fprintln(stdout, "(!) No tables found")
+		exitIfEmpty()
 		return
 	}
 
 	for _, table := range tables {
-		fmt.Printf("\n(>) Table: %s\n", table)
+		fmt.Fprintf(output, "\n(>) Table: %s\n", table)
 
-		colRows, err := db.Query(`
+		ctx, cancel := queryContext()
+		colRows, err := db.QueryContext(ctx, `
             SELECT column_name
             FROM information_schema.columns
             WHERE table_name = $1
             ORDER BY ordinal_position;
         `, table)
 		if err != nil {
-			fmt.Printf("(!) Failed to read columns for %s: %v\n", table, err)
+			cancel()
+			fmt.Fprintf(stdout, "(!) Failed to read columns for %s: %s\n", table, describeQueryErr(err))
 			continue
 		}
 
 		for colRows.Next() {
 			var colName string
 			if err := colRows.Scan(&colName); err != nil {
-				fmt.Printf("(!) Failed to read column: %v\n", err)
+				fmt.Fprintf(stdout, "(!) Failed to read column: %v\n", err)
 				continue
 			}
-			fmt.Printf("    - %s\n", colName)
+			fmt.Fprintf(output, "    - %s\n", colName)
 		}
 		colRows.Close()
+		cancel()
 	}
 }
 
 // --- Other utilities ---
-func showPing(db *sql.DB) {
+
+// exitCode carries a requested exit status out of a batch step so the runner
+// can record it instead of terminating the process.
+type exitCode int
+
+var inBatch bool
+
+func exit(code int) {
+	if inBatch {
+		panic(exitCode(code))
+	}
+	finishPager()
+	writeAudit(code)
+	os.Exit(code)
+}
+
+// noteWarning records that an advisory warning was printed, for
+// --exit-on-warning.
+func noteWarning() {
+	warningsEmitted = true
+}
+
+func exitIfEmpty() {
+	if failOnEmpty {
+		exit(exitEmpty)
+	}
+}
+
+func showPing(db *sql.DB, args []string) {
+	args, epoch := popFlag(args, "--epoch")
+	args, raw := popFlag(args, "--raw")
+	_, countStr, hasCount := popValue(args, "--count")
+
+	if hasCount {
+		n, err := strconv.Atoi(countStr)
+		if err != nil || n <= 0 {
+			fmt.Fprintln(stdout, "(!) --count expects a positive number")
+			exit(1)
+		}
+		showPingStats(db, n)
+		return
+	}
+
+	query := "SELECT NOW();"
+	if epoch {
+		query = "SELECT extract(epoch FROM now())::text;"
+	}
+
 	var now string
-	if err := db.QueryRow("SELECT NOW();").Scan(&now); err != nil {
-		fmt.Printf("(X) Failed to query DB: %v\n", err)
-		os.Exit(1)
+	if err := db.QueryRow(query).Scan(&now); err != nil {
+		fmt.Fprintf(stdout, "(X) Failed to query DB: %v\n", err)
+		exit(1)
+	}
+
+	if raw {
+		fmt.Fprintln(output, now)
+		return
 	}
-	fmt.Printf("(✓) Postgres time: %s\n", now)
+	fmt.Fprintf(output, "(✓) Postgres time: %s\n", now)
 }
 
-func showAdmins(db *sql.DB) {
+// showPingStats times n SELECT 1 round trips over the open connection and
+// summarizes them like ping(8).
+func showPingStats(db *sql.DB, n int) {
+	var rtts []time.Duration
+	for i := 1; i <= n; i++ {
+		start := time.Now()
+		var one int
+		if err := db.QueryRow("SELECT 1;").Scan(&one); err != nil {
+			fmt.Fprintf(stdout, "(X) seq=%d failed: %v\n", i, err)
+			continue
+		}
+		rtt := time.Since(start)
+		rtts = append(rtts, rtt)
+		fmt.Fprintf(output, "(✓) seq=%d time=%s\n", i, rtt.Round(time.Microsecond))
+	}
+
+	fmt.Fprintln(output, "")
+	fmt.Fprintf(output, "--- %d queries, %d ok, %d failed ---\n", n, len(rtts), n-len(rtts))
+	if len(rtts) == 0 {
+		exit(1)
+	}
+
+	slices.Sort(rtts)
+	var total time.Duration
+	for _, d := range rtts {
+		total += d
+	}
+	p95 := rtts[(len(rtts)*95+99)/100-1]
+	fmt.Fprintf(output, "min/avg/max/p95 = %s/%s/%s/%s\n",
+		rtts[0].Round(time.Microsecond),
+		(total / time.Duration(len(rtts))).Round(time.Microsecond),
+		rtts[len(rtts)-1].Round(time.Microsecond),
+		p95.Round(time.Microsecond))
+	if len(rtts) < n {
+		exit(1)
+	}
+}
+
+func showTCPPing(host, port string) {
+	addr := net.JoinHostPort(host, port)
+	start := time.Now()
+	conn, err := net.DialTimeout("tcp", addr, 5*time.Second)
+	if err != nil {
+		fmt.Fprintf(stdout, "(X) TCP connection to %s failed: %v\n", addr, err)
+		exit(1)
+	}
+	conn.Close()
+	fmt.Fprintf(output, "(✓) TCP connection to %s succeeded in %s\n", addr, time.Since(start).Round(time.Millisecond))
+}
+
+// showAdmins lists SUPERUSER and CREATEROLE roles; --count adds a total.
+func showAdmins(db *sql.DB, args []string, f outputFormat) {
+	_, withCount := popFlag(args, "--count")
 	rows, err := db.Query(`
         SELECT rolname 
         FROM pg_roles 
@@ -433,8 +1368,8 @@ func showAdmins(db *sql.DB) {
         ORDER BY rolname;
     `)
 	if err != nil {
-		fmt.Printf("(X) Failed to query admin users: %v\n", err)
-		os.Exit(1)
+		fmt.Fprintf(stdout, "(X) Failed to query admin users: %v\n", err)
+		exit(1)
 	}
 	defer rows.Close()
 
@@ -442,23 +1377,197 @@ func showAdmins(db *sql.DB) {
 	for rows.Next() {
 		var rol string
 		if err := rows.Scan(&rol); err != nil {
-			fmt.Printf("(!) Failed to read row: %v\n", err)
+			fmt.Fprintf(stdout, "(!) Failed to read row: %v\n", err)
 			continue
 		}
 		admins = append(admins, rol)
 	}
 
-	if len(admins) > 0 {
-		fmt.Println("(✓) Admin users:")
+	if f != formatTable {
+		data := make([][]string, len(admins))
+		for i, a := range admins {
+			data[i] = []string{a}
+		}
+		if withCount {
+			emitCountedRows(f, "admins", "admin user(s)", []string{"rolname"}, data)
+		} else {
+			emitRows(f, []string{"rolname"}, data)
+		}
+		if len(admins) == 0 {
+			exitIfEmpty()
+		}
+		return
+	}
+
+	if len(admins) > 0 && tableStyle != styleDefault {
+		data := make([][]string, len(admins))
+		for i, a := range admins {
+			data[i] = []string{a}
+		}
+		renderTable([]string{"rolname"}, data)
+		if withCount {
+			fmt.Fprintf(output, "%d admin user(s)\n", len(admins))
+		}
+	} else if len(admins) > 0 {
+		fmt.Fprintln(output, "(✓) Admin users:")
 		for _, a := range admins {
-			fmt.Printf("  (-) %s\n", a)
+			fmt.Fprintf(output, "  (-) %s\n", a)
+		}
+		if withCount {
+			fmt.Fprintf(output, "%d admin user(s)\n", len(admins))
 		}
 	} else {
-		fmt.Println("(!) No admin users found")
+		fmt.Fprintln(stdout, "(!) No admin users found")
+		exitIfEmpty()
 	}
 }
 
+// showUsers lists every role that can log in, with its privilege flags.
+func showUsers(db *sql.DB, args []string, f outputFormat) {
+	_, withCount := popFlag(args, "--count")
+	rows, err := db.Query(roleAttrsQuery + `
+		WHERE rolcanlogin
+		ORDER BY rolname
+	`)
+	if err != nil {
+		fmt.Fprintf(stdout, "(X) Failed to query login roles: %v\n", err)
+		exit(1)
+	}
+	defer rows.Close()
+
+	yesNo := func(b bool) string {
+		if b {
+			return "yes"
+		}
+		return "no"
+	}
+
+	var data [][]string
+	for rows.Next() {
+		r, err := scanRoleAttrs(rows)
+		if err != nil {
+			fmt.Fprintf(stdout, "(!) Failed to read row: %v\n", err)
+			continue
+		}
+		data = append(data, []string{r.rolname, yesNo(r.rolsuper), yesNo(r.rolcreatedb), yesNo(r.rolcreaterole), formatConnLimit(r.rolconnlimit)})
+	}
+
+	headers := []string{"role", "superuser", "createdb", "createrole", "connlimit"}
+	if f != formatTable {
+		if withCount {
+			emitCountedRows(f, "users", "login role(s)", headers, data)
+		} else {
+			emitRows(f, headers, data)
+		}
+		if len(data) == 0 {
+			exitIfEmpty()
+		}
+		return
+	}
+
+	if len(data) == 0 {
+		fmt.Fprintln(stdout, "(!) No login roles found")
+		exitIfEmpty()
+		return
+	}
+	if withCount {
+		emitCountedRows(f, "users", "login role(s)", headers, data)
+		return
+	}
+	renderTable(headers, data)
+}
+
+func showDatabases(db *sql.DB, args []string) {
+	_, all := popFlag(args, "--all")
+
+	rows, err := db.Query(`
+		SELECT
+			d.datname,
+			pg_get_userbyid(d.datdba),
+			CASE WHEN has_database_privilege(d.oid, 'CONNECT')
+				THEN pg_size_pretty(pg_database_size(d.oid))
+				ELSE 'no access'
+			END
+		FROM pg_database d
+		WHERE $1 OR NOT d.datistemplate
+		ORDER BY d.datname;
+	`, all)
+	if err != nil {
+		fmt.Fprintf(stdout, "(X) Failed to query databases: %v\n", err)
+		exit(1)
+	}
+	defer rows.Close()
+
+	count := 0
+	for rows.Next() {
+		var name, owner, size string
+		if err := rows.Scan(&name, &owner, &size); err != nil {
+			fmt.Fprintf(stdout, "(!) Failed to read row: %v\n", err)
+			continue
+		}
+		if count == 0 {
+			fmt.Fprintln(output, "(✓) Databases:")
+		}
+		count++
+		fmt.Fprintf(output, "  (-) %-30s owner: %-20s size: %s\n", name, owner, size)
+	}
+
+	if count == 0 {
+		fmt.Fprintln(stdout, "(!) No databases found")
+		exitIfEmpty()
+	}
+}
+
+// showExtensions lists installed extensions with the newest version the
+// server has available, flagging those ALTER EXTENSION ... UPDATE would move.
+func showExtensions(db *sql.DB) {
+	rows, err := db.Query(`
+		SELECT e.extname, e.extversion, coalesce(a.default_version, '')
+		FROM pg_extension e
+		LEFT JOIN pg_available_extensions a ON a.name = e.extname
+		ORDER BY e.extname;
+	`)
+	if err != nil {
+		fmt.Fprintf(stdout, "(X) Failed to query extensions: %v\n", err)
+		exit(1)
+	}
+	defer rows.Close()
+
+	count, upgradable := 0, 0
+	for rows.Next() {
+		var name, installed, latest string
+		if err := rows.Scan(&name, &installed, &latest); err != nil {
+			fmt.Fprintf(stdout, "(!) Failed to read row: %v\n", err)
+			continue
+		}
+		if count == 0 {
+			fmt.Fprintln(output, "(✓) Extensions:")
+		}
+		count++
+		line := fmt.Sprintf("  (-) %-30s installed: %-10s latest: %s", name, installed, latest)
+		if latest != "" && latest != installed {
+			line += "  (upgradable)"
+			upgradable++
+		}
+		fmt.Fprintln(output, line)
+	}
+
+	if count == 0 {
+		fmt.Fprintln(stdout, "(!) No extensions installed")
+		exitIfEmpty()
+		return
+	}
+	if upgradable > 0 {
+		fmt.Fprintf(stdout, "(!) %d extension(s) can be upgraded with ALTER EXTENSION ... UPDATE\n", upgradable)
+	}
+}
+
+func showVersion() {
+	fmt.Fprintf(stdout, "hvmd %s (commit %s, built %s)\n", version, commit, buildDate)
+}
+
 func showHelp(coreMode bool) {
+	width := termWidth()
 	hivemind := `                           👁️
                            ╱│╲
                           o   o
@@ -469,57 +1578,196 @@ func showHelp(coreMode bool) {
                      ╱│╲ ╱│╲ ╱│╲ ╱│╲
                     H I V E ● M I N D`
 
-	fmt.Println("👁····························································👁")
-	fmt.Println("👁··········<  hvmd  | Database communication CLI >···········👁")
-	fmt.Println("👁····························································👁")
-	fmt.Println(hivemind)
-	fmt.Println("👁····························································👁")
-	fmt.Println("Usage: hvmd command")
-	fmt.Println("")
-	fmt.Println("Commands:")
-	fmt.Println("")
-	fmt.Println("  ping      - Show current Postgres server time")
-	fmt.Println("  admins    - List all DB admin users (SUPERUSER or CREATEROLE)")
-	fmt.Println("  help      - Show this help message")
-	fmt.Println("  readdb    - Show database tables and column names")
-	fmt.Println("")
+	fmt.Fprintln(stdout, rule("👁", "👁", width))
+	fmt.Fprintln(stdout, titledRule("👁", "<  hvmd  | Database communication CLI >", "👁", width))
+	fmt.Fprintln(stdout, rule("👁", "👁", width))
+	fmt.Fprintln(stdout, hivemind)
+	fmt.Fprintln(stdout, rule("👁", "👁", width))
+	fmt.Fprintln(stdout, "Usage: hvmd command [flags]")
+	fmt.Fprintln(stdout, "")
+	fmt.Fprintln(stdout, "  --fail-on-empty - Exit with code 3 when a listing returns no rows")
+	fmt.Fprintln(stdout, "  --env-file <path>")
+	fmt.Fprintln(stdout, "                  - Load connection settings from <path> instead of .env")
+	fmt.Fprintln(stdout, "  --profile <name>")
+	fmt.Fprintln(stdout, "                  - Connect using a profile from ~/.hvmd/profiles.json")
+	fmt.Fprintln(stdout, "  --host, --port, --user, --dbname, --sslmode <value>")
+	fmt.Fprintln(stdout, "                  - Override the connection settings for one run; with")
+	fmt.Fprintln(stdout, "                    --password-stdin no .env or environment is needed at all")
+	fmt.Fprintln(stdout, "                    DATABASE_URL=postgres://... replaces the POSTGRES_* variables")
+	fmt.Fprintln(stdout, "  --retries <n>   - Retry a failed connection n times with backoff")
+	fmt.Fprintln(stdout, "  --retry-delay <d>")
+	fmt.Fprintln(stdout, "                  - Initial delay between retries, doubled each time (default 1s)")
+	fmt.Fprintln(stdout, "  --password-stdin")
+	fmt.Fprintln(stdout, "                  - Read the password from stdin (or set POSTGRES_PASSWORD_FILE)")
+	fmt.Fprintln(stdout, "  --password-prompt")
+	fmt.Fprintln(stdout, "                  - Ask for the password on the terminal without echo")
+	fmt.Fprintln(stdout, "  --explain-access")
+	fmt.Fprintln(stdout, "                  - Say why core access is granted or denied for this role")
+	fmt.Fprintln(stdout, "  --tunnel <user@bastion[:port]>")
+	fmt.Fprintln(stdout, "                  - Reach Postgres through an SSH bastion using the stored key")
+	fmt.Fprintln(stdout, "  --timeout <s>   - Give up on any single schema query after s seconds")
+	fmt.Fprintln(stdout, "  --format <f>    - table (default), csv or json for admins, readdb, query, activity")
+	fmt.Fprintln(stdout, "                    (--json is short for --format=json)")
+	fmt.Fprintln(stdout, "  --json-pretty   - Indent JSON for reading (compact by default)")
+	fmt.Fprintln(stdout, "  --table-style <s>")
+	fmt.Fprintln(stdout, "                  - Draw tables as plain columns, markdown pipe tables or box")
+	fmt.Fprintln(stdout, "  --output <path> - Write results to <path>; banners and errors stay on screen")
+	fmt.Fprintln(stdout, "  --pager         - Show output through $PAGER (default less -R) once the command ends")
+	fmt.Fprintln(stdout, "  --no-pager      - Never page (the default)")
+	fmt.Fprintln(stdout, "  --tee=<file>    - Mirror all output to a log file")
+	fmt.Fprintln(stdout, "  --no-color      - Don't color readdb columns (also NO_COLOR)")
+	fmt.Fprintln(stdout, "  --no-emoji      - Plain ASCII markers (also NO_COLOR or HVMD_ASCII=1)")
+	fmt.Fprintln(stdout, "  --verbose       - Print debug details (connection, timings, retries) to stderr")
+	fmt.Fprintln(stdout, "  --trace         - Log every SQL statement and its duration to stderr")
+	fmt.Fprintln(stdout, "  --quiet         - Hide banners and progress lines")
+	fmt.Fprintln(stdout, "  --no-warnings   - Suppress advisory security warnings")
+	fmt.Fprintln(stdout, "  --exit-on-warning")
+	fmt.Fprintln(stdout, "                  - Exit with code 4 if any warning was printed (or HVMD_STRICT=1)")
+	fmt.Fprintln(stdout, "  --watch <s>     - Clear the screen and rerun the command every s seconds (Ctrl-C stops)")
+	fmt.Fprintln(stdout, "  --batch=<file>  - Run one command per line over a single connection")
+	fmt.Fprintln(stdout, "                    (stops at the first failure unless --continue-on-error)")
+	fmt.Fprintln(stdout, "")
+	fmt.Fprintln(stdout, "Commands:")
+	fmt.Fprintln(stdout, "")
+	fmt.Fprintln(stdout, "  ping      - Show current Postgres server time")
+	fmt.Fprintln(stdout, "              --tcp-only  only check that host:port accepts TCP")
+	fmt.Fprintln(stdout, "              --epoch     print server time as a Unix epoch")
+	fmt.Fprintln(stdout, "              --raw       print the bare value only")
+	fmt.Fprintln(stdout, "              --count N   time N round trips and print min/avg/max/p95")
+	fmt.Fprintln(stdout, "  connstring")
+	fmt.Fprintln(stdout, "            - Print the resolved connection string with the password masked")
+	fmt.Fprintln(stdout, "  admins    - List all DB admin users (SUPERUSER or CREATEROLE)")
+	fmt.Fprintln(stdout, "              --count     add a total (a \"count\" field with --json)")
+	fmt.Fprintln(stdout, "  users     - List every role that can log in, with its flags and connection limit")
+	fmt.Fprintln(stdout, "              --count     add a total (a \"count\" field with --json)")
+	fmt.Fprintln(stdout, "  databases [--all]")
+	fmt.Fprintln(stdout, "            - List databases with owner and size (--all includes templates)")
+	fmt.Fprintln(stdout, "  extensions")
+	fmt.Fprintln(stdout, "            - List installed extensions and flag those with a newer version")
+	fmt.Fprintln(stdout, "  healthcheck")
+	fmt.Fprintln(stdout, "            - Print OK or FAIL and exit 0 or 2, for monitors and cron")
+	fmt.Fprintln(stdout, "  doctor    - Run common health checks and print a verdict")
+	fmt.Fprintln(stdout, "  encoding-check")
+	fmt.Fprintln(stdout, "            - Show server/client encodings and collation, warn on mismatch")
+	fmt.Fprintln(stdout, "  functions [schema]")
+	fmt.Fprintln(stdout, "            - List functions with arguments, return type and language")
+	fmt.Fprintln(stdout, "  views [schema] [--definition <name>]")
+	fmt.Fprintln(stdout, "            - List views and materialized views, or print one's SQL")
+	fmt.Fprintln(stdout, "  help      - Show this help message")
+	fmt.Fprintln(stdout, "  version   - Show version, commit and build date")
+	fmt.Fprintln(stdout, "  profiles  - List configured connection profiles")
+	fmt.Fprintln(stdout, "  whoami    - Show the connected role and its login/superuser flags")
+	fmt.Fprintln(stdout, "  tables    - List table names only")
+	fmt.Fprintln(stdout, "  describe <table>")
+	fmt.Fprintln(stdout, "            - Columns, defaults, keys and indexes of one table")
+	fmt.Fprintln(stdout, "  readdb [table]")
+	fmt.Fprintln(stdout, "            - Show database tables and column names, or just one table")
+	fmt.Fprintln(stdout, "              --table-filter=<glob> | --table-regex=<pattern>")
+	fmt.Fprintln(stdout, "              --format=csv|json  print the schema as CSV or a JSON document")
+	fmt.Fprintln(stdout, "  completion <bash|zsh|fish>")
+	fmt.Fprintln(stdout, "            - Print a shell completion script (add --core to include core commands)")
+	fmt.Fprintln(stdout, "  shell     - Run commands interactively over one connection ('exit' to leave)")
+	fmt.Fprintln(stdout, "  query-history [--last N]")
+	fmt.Fprintln(stdout, "            - Show recent ad-hoc queries (HVMD_HISTORY=1 to record)")
+	fmt.Fprintln(stdout, "")
+	fmt.Fprintln(stdout, "  Any other command runs hvmd-<command> from PATH, if present, with the")
+	fmt.Fprintln(stdout, "  connection settings in PGHOST, PGPORT, PGUSER, PGPASSWORD, PGDATABASE.")
+	fmt.Fprintln(stdout, "")
 	if coreMode {
-		fmt.Println("☢️  ··························································☢️")
-		fmt.Println("{👁️  } HIVEMIND CORE:")
-		fmt.Println("")
-		fmt.Println("Usage: hvmd command --core")
-		fmt.Println("")
-		fmt.Println("  identify --core     - Show current user privileges and core access")
-		fmt.Println("  testssh --core      - Run a core-only SSH key test")
-		fmt.Println("  readdb --core       - Read database schema and admin info")
-		fmt.Println("  help --core         - You're already fkn here")
-		fmt.Println("")
-		fmt.Println("Secret Commands public (no --core):")
-		fmt.Println("")
-		fmt.Println("  addadminsshkey      - Add your SSH public key to .key file")
-		fmt.Println("  catssh              - Display SSH key from .key file")
-		fmt.Println("")
-		fmt.Println("☢️  ·························································☢️")
+		fmt.Fprintln(stdout, rule("☢️  ", "☢️", width))
+		fmt.Fprintln(stdout, "{👁️  } HIVEMIND CORE:")
+		fmt.Fprintln(stdout, "")
+		fmt.Fprintln(stdout, "Usage: hvmd command --core")
+		fmt.Fprintln(stdout, "")
+		fmt.Fprintln(stdout, "  identify --core     - Show current user privileges and core access")
+		fmt.Fprintln(stdout, "  testssh --core      - Connect to SSH_USER@SSH_HOST[:SSH_PORT] with the stored key")
+		fmt.Fprintln(stdout, "  readdb --core       - Read database schema and admin info")
+		fmt.Fprintln(stdout, "  readdb --counts --core")
+		fmt.Fprintln(stdout, "                      - Also print each table's row count (slow on big tables)")
+		fmt.Fprintln(stdout, "  query \"SELECT ...\" --core")
+		fmt.Fprintln(stdout, "                      - Run a read-only SELECT/WITH and print the results")
+		fmt.Fprintln(stdout, "  query \"SELECT ...\" --explain [--analyze] --core")
+		fmt.Fprintln(stdout, "                      - Print the plan; --analyze really runs the statement")
+		fmt.Fprintln(stdout, "  peek <table> [--limit n] --core")
+		fmt.Fprintln(stdout, "                      - Print the first rows of a table (default 10)")
+		fmt.Fprintln(stdout, "  dump <table> <file.csv> [--null <text>] --core")
+		fmt.Fprintln(stdout, "                      - Stream a table to CSV with a header row")
+		fmt.Fprintln(stdout, "  sequences --core    - Show public sequences, their last value and headroom")
+		fmt.Fprintln(stdout, "  sizes --core        - Show database and table disk usage, largest first")
+		fmt.Fprintln(stdout, "  settings [--names a,b,c] --core")
+		fmt.Fprintln(stdout, "                      - Show key server settings with unit and source")
+		fmt.Fprintln(stdout, "  test-write --core   - Create, fill and drop a table in a rolled-back transaction")
+		fmt.Fprintln(stdout, "  schema-diff --profile-a <name> --profile-b <name> --core")
+		fmt.Fprintln(stdout, "                      - List tables and columns that differ between two profiles")
+		fmt.Fprintln(stdout, "  export-schema <file> --core")
+		fmt.Fprintln(stdout, "                      - Write CREATE TABLE statements for public tables")
+		fmt.Fprintln(stdout, "  functions [schema] --definition <name> --core")
+		fmt.Fprintln(stdout, "                      - Print a function's CREATE statement")
+		fmt.Fprintln(stdout, "  missing-fk-indexes [--emit-sql] --core")
+		fmt.Fprintln(stdout, "                      - List foreign keys without a supporting index")
+		fmt.Fprintln(stdout, "  vacuum-status [--threshold pct] --core")
+		fmt.Fprintln(stdout, "                      - Rank tables by dead tuples, flag those above pct (20)")
+		fmt.Fprintln(stdout, "  audit-superusers --core")
+		fmt.Fprintln(stdout, "                      - List superusers, warn above HVMD_MAX_SUPERUSERS (3) and flag")
+		fmt.Fprintln(stdout, "                        those that can log in")
+		fmt.Fprintln(stdout, "  no-primary-key [--emit-sql] --core")
+		fmt.Fprintln(stdout, "                      - List public tables without a primary key")
+		fmt.Fprintln(stdout, "  export-roles [--with-passwords] --core")
+		fmt.Fprintln(stdout, "                      - Print CREATE ROLE and GRANT statements for all roles")
+		fmt.Fprintln(stdout, "  roles-tree --core   - Show role membership as a tree of groups and members")
+		fmt.Fprintln(stdout, "  grants [table] --core")
+		fmt.Fprintln(stdout, "                      - Show who holds which privileges on a table, or on all")
+		fmt.Fprintln(stdout, "  backup-roles <file> --core")
+		fmt.Fprintln(stdout, "                      - Write CREATE/ALTER ROLE statements, without passwords")
+		fmt.Fprintln(stdout, "  set-connlimit <role> <n> [--dry-run] --core")
+		fmt.Fprintln(stdout, "                      - Set a role's connection limit (-1 for unlimited)")
+		fmt.Fprintln(stdout, "  grant-core <role> --core")
+		fmt.Fprintln(stdout, "  revoke-core <role> --core")
+		fmt.Fprintln(stdout, "                      - Delegate or withdraw core access without SUPERUSER")
+		fmt.Fprintln(stdout, "  core-users --core   - List roles with delegated core access")
+		fmt.Fprintln(stdout, "  activity --core     - List non-idle sessions, longest-running first")
+		fmt.Fprintln(stdout, "  activity --since <d> --core")
+		fmt.Fprintln(stdout, "                      - Only sessions whose query has run longer than d (e.g. 5m)")
+		fmt.Fprintln(stdout, "  locks --core        - Show blocked backends and who is blocking them")
+		fmt.Fprintln(stdout, "  activity --summary-only --core")
+		fmt.Fprintln(stdout, "  locks --summary-only --core")
+		fmt.Fprintln(stdout, "                      - Session counts, waiters, blockers and longest query")
+		fmt.Fprintln(stdout, "  cancel <pid> --core - Cancel a backend's running query")
+		fmt.Fprintln(stdout, "  kill <pid> --core   - Terminate a backend's session")
+		fmt.Fprintln(stdout, "  kill-idle --older-than <d> --core")
+		fmt.Fprintln(stdout, "                      - Terminate sessions idle in a transaction for longer than d")
+		fmt.Fprintln(stdout, "  help --core         - You're already fkn here")
+		fmt.Fprintln(stdout, "")
+		fmt.Fprintln(stdout, "Secret Commands public (no --core):")
+		fmt.Fprintln(stdout, "")
+		fmt.Fprintln(stdout, "  addadminsshkey [--force]")
+		fmt.Fprintln(stdout, "                      - Add your SSH public key to .key file")
+		fmt.Fprintln(stdout, "  catssh              - Display SSH key from .key file")
+		fmt.Fprintln(stdout, "  rotatessh           - Back up .key to .key.bak.<unix> and store a new key")
+		fmt.Fprintln(stdout, "                      (the key file is .key, or HVMD_KEY_FILE when set)")
+		fmt.Fprintln(stdout, "")
+		fmt.Fprintln(stdout, rule("☢️  ", "☢️", width))
 	} else {
-		fmt.Println("👁····························································👁")
+		fmt.Fprintln(stdout, rule("👁", "👁", width))
 	}
 }
 
 // --- Identity info ---
-func showIdentify(db *sql.DB, username string) {
-	var (
-		rolname        string
-		rolsuper       bool
-		rolinherit     bool
-		rolcreaterole  bool
-		rolcreatedb    bool
-		rolcanlogin    bool
-		rolreplication bool
-		rolconnlimit   int
-		rolvaliduntil  sql.NullTime
-	)
 
-	err := db.QueryRow(`
+// roleAttrs mirrors the pg_roles attributes shown by identify.
+type roleAttrs struct {
+	rolname        string
+	rolsuper       bool
+	rolinherit     bool
+	rolcreaterole  bool
+	rolcreatedb    bool
+	rolcanlogin    bool
+	rolreplication bool
+	rolconnlimit   int
+	rolvaliduntil  sql.NullTime
+}
+
+const roleAttrsQuery = `
 		SELECT 
 			rolname,
 			rolsuper,
@@ -530,55 +1778,132 @@ func showIdentify(db *sql.DB, username string) {
 			rolreplication,
 			rolconnlimit,
 			rolvaliduntil
-		FROM pg_roles 
-		WHERE rolname = $1
-	`, username).Scan(
-		&rolname,
-		&rolsuper,
-		&rolinherit,
-		&rolcreaterole,
-		&rolcreatedb,
-		&rolcanlogin,
-		&rolreplication,
-		&rolconnlimit,
-		&rolvaliduntil,
+		FROM pg_roles `
+
+// rowScanner is satisfied by both *sql.Row and *sql.Rows.
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanRoleAttrs(row rowScanner) (roleAttrs, error) {
+	var r roleAttrs
+	err := row.Scan(
+		&r.rolname,
+		&r.rolsuper,
+		&r.rolinherit,
+		&r.rolcreaterole,
+		&r.rolcreatedb,
+		&r.rolcanlogin,
+		&r.rolreplication,
+		&r.rolconnlimit,
+		&r.rolvaliduntil,
 	)
+	return r, err
+}
+
+func showIdentify(db *sql.DB, username string) {
+	r, err := scanRoleAttrs(db.QueryRow(roleAttrsQuery+`
+		WHERE rolname = $1
+	`, username))
 
 	if err != nil {
-		fmt.Printf("(X) Failed to query user information: %v\n", err)
-		os.Exit(1)
-	}
-
-	fmt.Println("{👁️  } Identity Information:")
-	fmt.Println("")
-	fmt.Printf("  {👁️  } Role Name:        %s\n", rolname)
-	fmt.Printf("  {👁️  } Superuser:        %v\n", rolsuper)
-	fmt.Printf("  {👁️  } Inherit:          %v\n", rolinherit)
-	fmt.Printf("  {👁️  } Create Role:      %v\n", rolcreaterole)
-	fmt.Printf("  {👁️  } Create DB:        %v\n", rolcreatedb)
-	fmt.Printf("  {👁️  } Can Login:        %v\n", rolcanlogin)
-	fmt.Printf("  {👁️  } Replication:      %v\n", rolreplication)
-	fmt.Printf("  {👁️  } Connection Limit: %d\n", rolconnlimit)
-
-	if rolvaliduntil.Valid {
-		fmt.Printf("  {👁️  } Valid Until:      %s\n", rolvaliduntil.Time.Format("2006-01-02 15:04:05"))
+		fmt.Fprintf(stdout, "(X) Failed to query user information: %v\n", err)
+		exit(1)
+	}
+
+	fmt.Fprintln(output, "{👁️  } Identity Information:")
+	fmt.Fprintln(output, "")
+	fmt.Fprintf(output, "  {👁️  } Role Name:        %s\n", r.rolname)
+	fmt.Fprintf(output, "  {👁️  } Superuser:        %v\n", r.rolsuper)
+	fmt.Fprintf(output, "  {👁️  } Inherit:          %v\n", r.rolinherit)
+	fmt.Fprintf(output, "  {👁️  } Create Role:      %v\n", r.rolcreaterole)
+	fmt.Fprintf(output, "  {👁️  } Create DB:        %v\n", r.rolcreatedb)
+	fmt.Fprintf(output, "  {👁️  } Can Login:        %v\n", r.rolcanlogin)
+	fmt.Fprintf(output, "  {👁️  } Replication:      %v\n", r.rolreplication)
+	fmt.Fprintf(output, "  {👁️  } Connection Limit: %d\n", r.rolconnlimit)
+
+	var inUse int
+	err = db.QueryRow(`SELECT count(*) FROM pg_stat_activity WHERE usename = $1`, username).Scan(&inUse)
+	if err == nil {
+		fmt.Fprintf(output, "  {👁️  } Connections Used: %d\n", inUse)
+	}
+
+	if r.rolvaliduntil.Valid {
+		fmt.Fprintf(output, "  {👁️  } Valid Until:      %s\n", r.rolvaliduntil.Time.Format("2006-01-02 15:04:05"))
 	} else {
-		fmt.Printf("  {👁️  } Valid Until:      No expiration\n")
+		fmt.Fprintf(output, "  {👁️  } Valid Until:      No expiration\n")
 	}
 
-	fmt.Println("")
+	fmt.Fprintln(stdout, "")
+
+	if err == nil {
+		warnIfNearConnLimit(inUse, r.rolconnlimit)
+	}
 
-	if rolsuper {
-		fmt.Println("{👁️  } CORE ACCESS GRANTED")
+	if r.rolsuper {
+		warnIfSuperuser(true)
+		fmt.Fprintln(stdout, "{👁️  } CORE ACCESS GRANTED")
 	} else {
-		fmt.Printf("{⚠️     👁️  👁️   ⚠️ } Not a superuser - Your breach has been logged at %s\n", time.Now().Format("15:04:05.000"))
+		fmt.Fprintf(stdout, "{⚠️     👁️  👁️   ⚠️ } Not a superuser - Your breach has been logged at %s\n", time.Now().Format("15:04:05.000"))
 	}
 }
 
+func showWhoami(db *sql.DB, username string) {
+	var canLogin, isSuper bool
+	err := db.QueryRow(`
+		SELECT rolcanlogin, rolsuper
+		FROM pg_roles
+		WHERE rolname = $1
+	`, username).Scan(&canLogin, &isSuper)
+	if err != nil {
+		fmt.Fprintf(stdout, "(X) Failed to query role: %v\n", err)
+		exit(1)
+	}
+
+	warnIfSuperuser(isSuper)
+	fmt.Fprintf(output, "(✓) %s (login: %v, superuser: %v)\n", username, canLogin, isSuper)
+}
+
+// warnIfNearConnLimit warns when a role uses more than 80% of its connection
+// limit. -1 means unlimited; 0 means the role may not open new sessions.
+func warnIfNearConnLimit(inUse, limit int) {
+	if limit < 0 || noWarnings {
+		return
+	}
+	if limit == 0 {
+		noteWarning()
+		fmt.Fprintln(stdout, "{⚠️  } Connection limit is 0. New sessions for this role will be refused.")
+		fmt.Fprintln(stdout, "")
+		return
+	}
+	if inUse*100 <= limit*80 {
+		return
+	}
+	noteWarning()
+	fmt.Fprintf(stdout, "{⚠️  } Using %d of %d allowed connections. New sessions for this role may be refused.\n", inUse, limit)
+	fmt.Fprintln(stdout, "")
+}
+
+// superuserWarned keeps the --verbose startup check and identify/whoami
+// from printing the superuser warning twice.
+var superuserWarned bool
+
+// warnIfSuperuser nudges users away from doing routine work as a superuser.
+func warnIfSuperuser(isSuper bool) {
+	if !isSuper || noWarnings || superuserWarned {
+		return
+	}
+	superuserWarned = true
+	noteWarning()
+	fmt.Fprintln(stdout, "{⚠️  } Connected as a SUPERUSER. Prefer a least-privilege role for day-to-day work.")
+	fmt.Fprintln(stdout, "    Silence with --no-warnings if this is intentional")
+	fmt.Fprintln(stdout, "")
+}
+
 // --- Suggestion helper ---
 func suggestSimilar(cmd string) {
 	if strings.Contains(cmd, "core") {
-		fmt.Println("    Try: hvmd help")
+		fmt.Fprintln(stdout, "    Try: hvmd help")
 		return
 	}
 
@@ -586,18 +1911,60 @@ func suggestSimilar(cmd string) {
 		"help":   {"hlep", "halp", "hel", "hepl", "h", "-h", "--help"},
 		"ping":   {"pong", "pign", "pin", "pign", "p"},
 		"admins": {"admin", "admn", "adm", "administrators", "users"},
+		"tables": {"tabels", "tbls", "tabls", "tablse", "tbl"},
+		"whoami": {"who", "whome", "myrole", "whomai", "whoiam"},
 	}
 
 	cmd = strings.ToLower(cmd)
 
+	// Closest known command by edit distance; core commands are only
+	// suggested to users who already have core access.
+	candidates := knownCommands(coreEnabled)
+	best, bestDist := "", -1
+	for _, c := range candidates {
+		if d := levenshtein(cmd, c); bestDist < 0 || d < bestDist {
+			best, bestDist = c, d
+		}
+	}
+	threshold := 2
+	if len(cmd) >= 6 {
+		threshold = 3
+	}
+	if bestDist > 0 && bestDist <= threshold {
+		fmt.Fprintf(stdout, "    Did you mean: hvmd %s\n", best)
+		return
+	}
+
 	for correct, typos := range suggestions {
 		for _, typo := range typos {
 			if strings.Contains(cmd, typo) || strings.Contains(typo, cmd) {
-				fmt.Printf("    Did you mean: hvmd %s\n", correct)
+				fmt.Fprintf(stdout, "    Did you mean: hvmd %s\n", correct)
 				return
 			}
 		}
 	}
 
-	fmt.Println("    Try: hvmd help")
+	fmt.Fprintln(stdout, "    Try: hvmd help")
+}
+
+// levenshtein returns the edit distance between a and b.
+func levenshtein(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(rb)]
 }
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/joho/godotenv"
+	"golang.org/x/crypto/scrypt"
+	"golang.org/x/term"
+)
+
+// --- Encrypted .key storage ---
+//
+// Layout: version (1 byte) | scrypt salt (16) | GCM nonce (12) | ciphertext.
+// The plaintext is the dotenv body (SSH_KEY=...) so readers keep using a
+// key/value map. Files written before encryption are still read as plain
+// dotenv.
+
+const keyFileVersion byte = 1
+
+const (
+	keySaltSize = 16
+	keySize     = 32
+)
+
+var errBadPassphrase = errors.New("wrong passphrase or corrupted .key")
+
+var stdinReader = bufio.NewReader(os.Stdin)
+
+// keyFilePath is where the SSH key is stored: HVMD_KEY_FILE, or .key in the
+// working directory. Every command that reads or writes the key goes
+// through it.
+func keyFilePath() string {
+	if path := os.Getenv("HVMD_KEY_FILE"); path != "" {
+		return path
+	}
+	return ".key"
+}
+
+// readKeyFile loads the key/value pairs stored in path, prompting for the
+// passphrase when the file is encrypted.
+func readKeyFile(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) == 0 || data[0] != keyFileVersion {
+		return godotenv.Unmarshal(string(data))
+	}
+
+	passphrase, err := readPassphrase(fmt.Sprintf("Passphrase for %s: ", path))
+	if err != nil {
+		return nil, err
+	}
+	plain, err := decryptKeyData(data, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	return godotenv.Unmarshal(string(plain))
+}
+
+// writeKeyFile encrypts env under a freshly prompted passphrase and writes it
+// to path with owner-only permissions.
+func writeKeyFile(path string, env map[string]string) error {
+	passphrase, err := readPassphrase(fmt.Sprintf("New passphrase for %s: ", path))
+	if err != nil {
+		return err
+	}
+	if len(passphrase) == 0 {
+		return errors.New("empty passphrase")
+	}
+	confirm, err := readPassphrase("Repeat passphrase: ")
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(passphrase, confirm) {
+		return errors.New("passphrases do not match")
+	}
+
+	body, err := godotenv.Marshal(env)
+	if err != nil {
+		return err
+	}
+	data, err := encryptKeyData([]byte(body+"\n"), passphrase)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0600)
+}
+
+func deriveKey(passphrase, salt []byte) ([]byte, error) {
+	return scrypt.Key(passphrase, salt, 1<<15, 8, 1, keySize)
+}
+
+func encryptKeyData(plain, passphrase []byte) ([]byte, error) {
+	salt := make([]byte, keySaltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	gcm, err := newKeyGCM(passphrase, salt)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	out := []byte{keyFileVersion}
+	out = append(out, salt...)
+	out = append(out, nonce...)
+	return gcm.Seal(out, nonce, plain, nil), nil
+}
+
+func decryptKeyData(data, passphrase []byte) ([]byte, error) {
+	if len(data) < 1+keySaltSize {
+		return nil, errBadPassphrase
+	}
+	salt := data[1 : 1+keySaltSize]
+	gcm, err := newKeyGCM(passphrase, salt)
+	if err != nil {
+		return nil, err
+	}
+
+	rest := data[1+keySaltSize:]
+	if len(rest) < gcm.NonceSize() {
+		return nil, errBadPassphrase
+	}
+	nonce, ciphertext := rest[:gcm.NonceSize()], rest[gcm.NonceSize():]
+	plain, err := gcm.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return nil, errBadPassphrase
+	}
+	return plain, nil
+}
+
+func newKeyGCM(passphrase, salt []byte) (cipher.AEAD, error) {
+	key, err := deriveKey(passphrase, salt)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// readPassphrase prompts on stderr and reads without echo when stdin is a
+// terminal, or a single line when it is piped.
+func readPassphrase(prompt string) ([]byte, error) {
+	fmt.Fprint(stderr, prompt)
+	fd := int(os.Stdin.Fd())
+	if term.IsTerminal(fd) {
+		p, err := term.ReadPassword(fd)
+		fmt.Fprintln(stderr)
+		return p, err
+	}
+
+	line, err := stdinReader.ReadString('\n')
+	if err != nil && line == "" {
+		return nil, err
+	}
+	return []byte(strings.TrimRight(line, "\r\n")), nil
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestKeyFileRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "hvmd.key")
+	t.Setenv("HVMD_KEY_FILE", path)
+	if got := keyFilePath(); got != path {
+		t.Fatalf("keyFilePath() = %q, want %q", got, path)
+	}
+
+	// Passphrases are read from stdinReader when stdin isn't a terminal:
+	// new, repeat, then the one asked for on read.
+	devNull, err := os.Open(os.DevNull)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer devNull.Close()
+	oldStdin, oldReader, oldStderr := os.Stdin, stdinReader, stderr
+	os.Stdin = devNull
+	stdinReader = bufio.NewReader(strings.NewReader("hunter2\nhunter2\nhunter2\n"))
+	stderr = io.Discard
+	t.Cleanup(func() { os.Stdin, stdinReader, stderr = oldStdin, oldReader, oldStderr })
+
+	const key = "ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIHvmdTestKey user@host"
+	if err := writeKeyFile(keyFilePath(), map[string]string{"SSH_KEY": key}); err != nil {
+		t.Fatalf("writeKeyFile: %v", err)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("stat %s: %v", path, err)
+	}
+	if perm := info.Mode().Perm(); perm != 0600 {
+		t.Errorf("permissions = %o, want 600", perm)
+	}
+
+	env, err := readKeyFile(keyFilePath())
+	if err != nil {
+		t.Fatalf("readKeyFile: %v", err)
+	}
+	if got := env["SSH_KEY"]; got != key {
+		t.Errorf("SSH_KEY = %q, want %q", got, key)
+	}
+}
@@ -0,0 +1,296 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/term"
+)
+
+// stdout and stderr are where every command prints. They point at the
+// process handles unless --tee mirrors them into a log file.
+var (
+	stdout io.Writer = os.Stdout
+	stderr io.Writer = os.Stderr
+)
+
+// output receives a command's primary results. It follows stdout unless
+// --output sends results to a file, leaving banners and errors on screen.
+var output io.Writer = os.Stdout
+
+// countingWriter counts the bytes written through it for --output's report.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(b []byte) (int, error) {
+	n, err := c.w.Write(b)
+	c.n += int64(n)
+	return n, err
+}
+
+var (
+	outputPath    string
+	outputCounter *countingWriter
+)
+
+// enableOutput sends primary output to a new file at path.
+func enableOutput(path string, ascii bool) {
+	f, err := os.Create(path)
+	if err != nil {
+		fmt.Fprintf(stderr, "(X) Failed to open output file: %v\n", err)
+		exit(1)
+	}
+	outputPath = path
+	outputCounter = &countingWriter{w: f}
+	output = outputCounter
+	if ascii {
+		output = asciiWriter{output}
+	}
+}
+
+// reportOutput says where --output went once the command has finished.
+func reportOutput() {
+	if outputCounter != nil {
+		infof("(✓) Wrote %d bytes to %s", outputCounter.n, outputPath)
+	}
+}
+
+// defaultWidth is the help layout width when the terminal size is unknown.
+const defaultWidth = 62
+
+// termWidth returns the width of the terminal on stdout, then $COLUMNS, then
+// defaultWidth.
+func termWidth() int {
+	if w, _, err := term.GetSize(int(os.Stdout.Fd())); err == nil && w > 0 {
+		return w
+	}
+	if w, err := strconv.Atoi(os.Getenv("COLUMNS")); err == nil && w > 0 {
+		return w
+	}
+	return defaultWidth
+}
+
+// rule draws a dotted horizontal line between two end caps, width runes wide.
+func rule(left, right string, width int) string {
+	return titledRule(left, "", right, width)
+}
+
+// titledRule centres title in a dotted rule between two end caps.
+func titledRule(left, title, right string, width int) string {
+	n := width - utf8.RuneCountInString(left) - utf8.RuneCountInString(title) - utf8.RuneCountInString(right)
+	n = max(n, 2)
+	return left + strings.Repeat("·", n/2) + title + strings.Repeat("·", n-n/2) + right
+}
+
+// outputFormat selects how data-producing commands render their results.
+type outputFormat int
+
+const (
+	formatTable outputFormat = iota
+	formatCSV
+	formatJSON
+)
+
+// jsonPretty indents JSON output under --json-pretty; the default is one
+// compact line per document for piping.
+var jsonPretty bool
+
+// parseFormat maps a --format value to its outputFormat.
+func parseFormat(s string) (outputFormat, bool) {
+	switch s {
+	case "table":
+		return formatTable, true
+	case "csv":
+		return formatCSV, true
+	case "json":
+		return formatJSON, true
+	}
+	return formatTable, false
+}
+
+// tableStyle selects how renderTable draws text tables. The default is the
+// psql-like layout; --table-style picks plain, markdown or box instead.
+type tableStyleKind int
+
+const (
+	styleDefault tableStyleKind = iota
+	stylePlain
+	styleMarkdown
+	styleBox
+)
+
+var tableStyle = styleDefault
+
+// parseTableStyle maps a --table-style value to its style.
+func parseTableStyle(s string) (tableStyleKind, bool) {
+	switch s {
+	case "plain":
+		return stylePlain, true
+	case "markdown":
+		return styleMarkdown, true
+	case "box":
+		return styleBox, true
+	}
+	return styleDefault, false
+}
+
+// Log levels: --quiet hides banners, --verbose adds debug lines on stderr.
+const (
+	levelQuiet = iota
+	levelNormal
+	levelDebug
+)
+
+var logLevel = levelNormal
+
+// infof prints banners and progress lines that --quiet suppresses.
+func infof(format string, a ...interface{}) {
+	if logLevel >= levelNormal {
+		fmt.Fprintf(stdout, format+"\n", a...)
+	}
+}
+
+// debugf prints diagnostics to stderr under --verbose so stdout stays clean.
+func debugf(format string, a ...interface{}) {
+	if logLevel >= levelDebug {
+		fmt.Fprintf(stderr, "[debug] "+format+"\n", a...)
+	}
+}
+
+// ANSI colors for schema output, applied through paint.
+const (
+	colorReset    = "\x1b[0m"
+	colorKey      = "\x1b[1;33m"
+	colorNotNull  = "\x1b[32m"
+	colorNullable = "\x1b[2m"
+)
+
+// colorEnabled is set only for an interactive terminal; NO_COLOR, --no-color
+// and --output all turn it off.
+var colorEnabled bool
+
+// paint wraps s in color when colors are enabled.
+func paint(color, s string) string {
+	if !colorEnabled {
+		return s
+	}
+	return color + s + colorReset
+}
+
+var ansiEscapeRe = regexp.MustCompile(`\x1b\[[0-9;]*[A-Za-z]`)
+
+// plainWriter strips ANSI escape sequences so log files stay readable while
+// the terminal keeps its colors.
+type plainWriter struct {
+	w io.Writer
+}
+
+func (p plainWriter) Write(b []byte) (int, error) {
+	if _, err := p.w.Write(ansiEscapeRe.ReplaceAll(b, nil)); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+// asciiReplacer maps every emoji status marker and help-art glyph to plain
+// ASCII. Longer markers come first so they win over their parts.
+var asciiReplacer = strings.NewReplacer(
+	"{⚠️     👁️  👁️   ⚠️ }", "[!]",
+	"{⚠️   }", "[!]",
+	"{⚠️  }", "[!]",
+	"{✅ }", "[ok]",
+	"{👁️  }", "[i]",
+	"{🗃️  }", "[i]",
+	"{🏷️  }", "[i]",
+	"{📚 }", "[i]",
+	"{🔒 }", "[i]",
+	"{🌐 }", "[i]",
+	"{🔑 }", "[i]",
+	"{🔗 }", "[i]",
+	"{📝 }", "[i]",
+	"{🔎 }", "[i]",
+	"{📊 }", "[i]",
+	"{⏳ }", "[i]",
+	"{🚧 }", "[!]",
+	"{🐢 }", "[i]",
+	"{🔢 }", "[i]",
+	"{🧪 }", "[i]",
+	"{💾 }", "[i]",
+	"{🐚 }", "[i]",
+	"{💤 }", "[i]",
+	"(✓)", "[ok]",
+	"(!)", "[!]",
+	"(X)", "[x]",
+	"(>)", "[i]",
+	"📝", "-",
+	"🔑", "*",
+	"🔗", ">",
+	"📇", "#",
+	"💎", "u",
+	"👥", "#",
+	"🐢", "!",
+	"🔓", "!",
+	"☢️", "!",
+	"💤", "z",
+	"👁️", "o",
+	"👁", "o",
+	"╱", "/",
+	"│", "|",
+	"─", "-",
+	"┌", "+",
+	"┬", "+",
+	"┐", "+",
+	"├", "+",
+	"┼", "+",
+	"┤", "+",
+	"└", "+",
+	"┴", "+",
+	"┘", "+",
+	"╲", "\\",
+	"●", "*",
+	"·", ".",
+	"…", "~",
+)
+
+// asciiWriter rewrites emoji markers for terminals and logs without UTF-8.
+type asciiWriter struct {
+	w io.Writer
+}
+
+func (a asciiWriter) Write(b []byte) (int, error) {
+	if _, err := io.WriteString(a.w, asciiReplacer.Replace(string(b))); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+// wantASCII reports whether emoji output was turned off via --no-emoji,
+// NO_COLOR or HVMD_ASCII.
+func wantASCII(noEmoji bool) bool {
+	return noEmoji || os.Getenv("NO_COLOR") != "" || os.Getenv("HVMD_ASCII") == "1"
+}
+
+// enableASCII routes stdout and stderr through the ASCII replacer.
+func enableASCII() {
+	stdout = asciiWriter{stdout}
+	stderr = asciiWriter{stderr}
+}
+
+// enableTee mirrors stdout and stderr into the file at path.
+func enableTee(path string) {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		fmt.Fprintf(stderr, "(X) Failed to open tee file: %v\n", err)
+		exit(1)
+	}
+	log := plainWriter{f}
+	stdout = io.MultiWriter(stdout, log)
+	stderr = io.MultiWriter(stderr, log)
+}
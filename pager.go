@@ -0,0 +1,85 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+)
+
+// --- Pager ---
+
+// pagerBuffer holds stdout until the command finishes, when finishPager
+// hands it to the pager. After disablePager it passes writes straight
+// through. mu keeps finishPager, which the interrupt handler may call from
+// its own goroutine, from racing the command's writes.
+type pagerBuffer struct {
+	mu     sync.Mutex
+	buf    bytes.Buffer
+	direct bool
+}
+
+func (p *pagerBuffer) Write(b []byte) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.direct {
+		return os.Stdout.Write(b)
+	}
+	return p.buf.Write(b)
+}
+
+var pager *pagerBuffer
+
+// enablePager starts collecting stdout for the pager. It must run before
+// --tee and --no-emoji wrap stdout so the log still sees output as it
+// happens. Paging is opt-in: buffered output shows nothing until the command
+// ends, which would hide ping --count, doctor and other progressive output.
+func enablePager() {
+	pager = &pagerBuffer{}
+	stdout = pager
+}
+
+// disablePager flushes what was collected and stops buffering, for commands
+// that prompt on stdout or redraw the screen.
+func disablePager() {
+	if pager == nil {
+		return
+	}
+	pager.mu.Lock()
+	defer pager.mu.Unlock()
+	if pager.direct {
+		return
+	}
+	os.Stdout.Write(pager.buf.Bytes())
+	pager.buf.Reset()
+	pager.direct = true
+}
+
+// finishPager shows the collected output through $PAGER (default less -R).
+// It is safe to call more than once, and from more than one goroutine.
+func finishPager() {
+	if pager == nil {
+		return
+	}
+	pager.mu.Lock()
+	defer pager.mu.Unlock()
+	if pager.direct {
+		return
+	}
+	out := pager.buf.Bytes()
+	pager.direct = true
+
+	cmdline := strings.Fields(os.Getenv("PAGER"))
+	if len(cmdline) == 0 {
+		cmdline = []string{"less", "-R"}
+	}
+	c := exec.Command(cmdline[0], cmdline[1:]...)
+	c.Stdin = bytes.NewReader(out)
+	c.Stdout, c.Stderr = os.Stdout, os.Stderr
+	if err := c.Start(); err != nil {
+		os.Stdout.Write(out)
+		return
+	}
+	c.Wait()
+}
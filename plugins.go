@@ -0,0 +1,59 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// --- External subcommands ---
+
+// pluginEnv carries the resolved connection settings to hvmd-<cmd>
+// plugins, as the standard PG* variables plus the full DSN in HVMD_DSN.
+var pluginEnv []string
+
+func setPluginEnv(host, port, user, password, dbname, sslmode, dsn string) {
+	pluginEnv = []string{
+		"PGHOST=" + host,
+		"PGPORT=" + port,
+		"PGUSER=" + user,
+		"PGPASSWORD=" + password,
+		"PGDATABASE=" + dbname,
+		"PGSSLMODE=" + sslmode,
+		"HVMD_DSN=" + dsn,
+	}
+}
+
+// runPlugin runs hvmd-<cmd> from PATH with the remaining args, the way git
+// runs its external subcommands. It reports false when there is no such
+// executable; the plugin's exit code becomes ours.
+func runPlugin(cmd string, args []string) bool {
+	if cmd == "" || strings.ContainsAny(cmd, `/\`) {
+		return false
+	}
+	path, err := exec.LookPath("hvmd-" + cmd)
+	if err != nil {
+		return false
+	}
+
+	env := append(os.Environ(), pluginEnv...)
+	if coreEnabled {
+		env = append(env, "HVMD_CORE=1")
+	}
+
+	debugf("running plugin %s", path)
+	c := exec.Command(path, args...)
+	c.Stdin, c.Stdout, c.Stderr = os.Stdin, stdout, stderr
+	c.Env = env
+	if err := c.Run(); err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			exit(exitErr.ExitCode())
+		}
+		fmt.Fprintf(stdout, "(X) Failed to run %s: %v\n", path, err)
+		exit(1)
+	}
+	return true
+}
@@ -0,0 +1,461 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/lib/pq"
+)
+
+// maxCellWidth caps how wide a single column may render in text tables.
+const maxCellWidth = 40
+
+// --- Ad-hoc queries ---
+func runQuery(db *sql.DB, args []string, f outputFormat) {
+	args, explain := popFlag(args, "--explain")
+	args, analyze := popFlag(args, "--analyze")
+	if len(args) == 0 {
+		fmt.Fprintln(stdout, "{⚠️  } Usage: hvmd query \"SELECT ...\" --core")
+		exit(1)
+	}
+	stmt := strings.Join(args, " ")
+
+	if !isReadOnlyStatement(stmt) {
+		fmt.Fprintln(stdout, "{⚠️  } Only SELECT and WITH statements are allowed")
+		exit(1)
+	}
+
+	recordHistory(stmt)
+
+	// The prefix check is a guard rail. The read-only transaction stops
+	// writes hidden in a CTE, and queryStatement keeps a trailing
+	// "; COMMIT; ..." from running outside it.
+	tx, err := db.BeginTx(interruptCtx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		fmt.Fprintf(stdout, "{⚠️  } Failed to start transaction: %v\n", err)
+		exit(1)
+	}
+	defer tx.Rollback()
+
+	if explain || analyze {
+		showPlan(tx, stmt, analyze)
+		return
+	}
+
+	ps, rows, err := queryStatement(tx, stmt)
+	if err != nil {
+		fmt.Fprintf(stdout, "{⚠️  } Query failed: %v\n", err)
+		exit(1)
+	}
+	defer ps.Close()
+	defer rows.Close()
+
+	headers, data, err := readRows(rows)
+	if err != nil {
+		fmt.Fprintf(stdout, "{⚠️  } Failed to read results: %v\n", err)
+		exit(1)
+	}
+
+	emitRows(f, headers, data)
+	if f == formatTable {
+		fmt.Fprintf(output, "(%d row(s))\n", len(data))
+	}
+	if len(data) == 0 {
+		exitIfEmpty()
+	}
+}
+
+// showPlan prints the plan for stmt. Plain EXPLAIN only plans; ANALYZE runs
+// the statement for real, still inside the caller's read-only transaction.
+func showPlan(tx *sql.Tx, stmt string, analyze bool) {
+	prefix := "EXPLAIN "
+	if analyze {
+		prefix = "EXPLAIN ANALYZE "
+		fmt.Fprintln(stdout, "{⚠️  } EXPLAIN ANALYZE executes the statement to measure it")
+	} else {
+		infof("{🔎 } Plan only, the statement is not executed")
+	}
+
+	ps, rows, err := queryStatement(tx, prefix+stmt)
+	if err != nil {
+		fmt.Fprintf(stdout, "{⚠️  } Explain failed: %v\n", err)
+		exit(1)
+	}
+	defer ps.Close()
+	defer rows.Close()
+
+	for rows.Next() {
+		var line string
+		if err := rows.Scan(&line); err != nil {
+			fmt.Fprintf(stdout, "{⚠️  } Failed to read plan: %v\n", err)
+			exit(1)
+		}
+		fmt.Fprintln(output, line)
+	}
+	if err := rows.Err(); err != nil {
+		fmt.Fprintf(stdout, "{⚠️  } Failed to read plan: %v\n", err)
+		exit(1)
+	}
+}
+
+// queryStatement runs stmt as a prepared statement. That forces the
+// extended protocol, which refuses more than one statement per call; a plain
+// tx.Query without arguments would send every statement in the string.
+func queryStatement(tx *sql.Tx, stmt string) (*sql.Stmt, *sql.Rows, error) {
+	ps, err := tx.PrepareContext(interruptCtx, stmt)
+	if err != nil {
+		return nil, nil, err
+	}
+	rows, err := ps.Query()
+	if err != nil {
+		ps.Close()
+		return nil, nil, err
+	}
+	return ps, rows, nil
+}
+
+// isReadOnlyStatement accepts only statements that start with SELECT or WITH.
+func isReadOnlyStatement(stmt string) bool {
+	s := strings.ToLower(strings.TrimSpace(stmt))
+	return strings.HasPrefix(s, "select") || strings.HasPrefix(s, "with")
+}
+
+// readRows scans an arbitrary result set into display strings.
+func readRows(rows *sql.Rows) ([]string, [][]string, error) {
+	headers, err := rows.Columns()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var data [][]string
+	for rows.Next() {
+		values := make([]interface{}, len(headers))
+		ptrs := make([]interface{}, len(headers))
+		for i := range values {
+			ptrs[i] = &values[i]
+		}
+		if err := rows.Scan(ptrs...); err != nil {
+			return nil, nil, err
+		}
+
+		row := make([]string, len(values))
+		for i, v := range values {
+			row[i] = formatValue(v)
+		}
+		data = append(data, row)
+	}
+	return headers, data, rows.Err()
+}
+
+func formatValue(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return "NULL"
+	case []byte:
+		return string(v)
+	case time.Time:
+		return v.Format("2006-01-02 15:04:05")
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// emitRows prints a result set as an aligned table, CSV with a header row,
+// or a JSON array of objects keyed by column name.
+func emitRows(f outputFormat, headers []string, data [][]string) {
+	switch f {
+	case formatCSV:
+		w := csv.NewWriter(output)
+		w.Write(headers)
+		if err := w.WriteAll(data); err != nil {
+			fmt.Fprintf(stderr, "(!) Failed to write CSV: %v\n", err)
+			exit(1)
+		}
+	case formatJSON:
+		emitJSON(rowObjects(headers, data))
+	default:
+		renderTable(headers, data)
+	}
+}
+
+// emitCountedRows is emitRows with a total: a trailing "N <noun>" line for
+// tables, and {"<key>": [...], "count": N} for JSON. CSV stays plain rows
+// with the total on stderr.
+func emitCountedRows(f outputFormat, key, noun string, headers []string, data [][]string) {
+	switch f {
+	case formatJSON:
+		emitJSON(map[string]interface{}{key: rowObjects(headers, data), "count": len(data)})
+	case formatCSV:
+		emitRows(f, headers, data)
+		fmt.Fprintf(stderr, "%d %s\n", len(data), noun)
+	default:
+		emitRows(f, headers, data)
+		fmt.Fprintf(output, "%d %s\n", len(data), noun)
+	}
+}
+
+// rowObjects turns a result set into JSON objects keyed by column name.
+func rowObjects(headers []string, data [][]string) []map[string]string {
+	objs := make([]map[string]string, len(data))
+	for i, row := range data {
+		obj := make(map[string]string, len(headers))
+		for j, h := range headers {
+			obj[h] = row[j]
+		}
+		objs[i] = obj
+	}
+	return objs
+}
+
+// emitJSON writes v as one JSON document, indented under --json-pretty.
+func emitJSON(v interface{}) {
+	enc := json.NewEncoder(output)
+	if jsonPretty {
+		enc.SetIndent("", "  ")
+	}
+	if err := enc.Encode(v); err != nil {
+		fmt.Fprintf(stderr, "(!) Failed to encode JSON: %v\n", err)
+		exit(1)
+	}
+}
+
+// renderTable prints headers and rows as aligned columns in tableStyle.
+func renderTable(headers []string, data [][]string) {
+	cell := truncateCell
+	if tableStyle == styleMarkdown {
+		cell = func(s string) string { return strings.ReplaceAll(truncateCell(s), "|", "\\|") }
+	}
+
+	widths := make([]int, len(headers))
+	for i, h := range headers {
+		widths[i] = utf8.RuneCountInString(cell(h))
+	}
+	for _, row := range data {
+		for i, c := range row {
+			widths[i] = max(widths[i], utf8.RuneCountInString(cell(c)))
+		}
+	}
+
+	sep, left, right := " | ", "", ""
+	switch tableStyle {
+	case stylePlain:
+		sep = "  "
+	case styleMarkdown:
+		left, right = "| ", " |"
+	case styleBox:
+		sep, left, right = " │ ", "│ ", " │"
+	}
+
+	printRow := func(cells []string) {
+		parts := make([]string, len(cells))
+		for i, c := range cells {
+			c = cell(c)
+			parts[i] = c + strings.Repeat(" ", widths[i]-utf8.RuneCountInString(c))
+		}
+		line := left + strings.Join(parts, sep) + right
+		if right == "" {
+			line = strings.TrimRight(line, " ")
+		}
+		fmt.Fprintln(output, line)
+	}
+	// rule draws a horizontal line from fill, with the given corners and
+	// column joints.
+	rule := func(fill, l, joint, r string) {
+		segs := make([]string, len(widths))
+		for i, w := range widths {
+			segs[i] = strings.Repeat(fill, w+2)
+		}
+		fmt.Fprintln(output, l+strings.Join(segs, joint)+r)
+	}
+
+	switch tableStyle {
+	case styleBox:
+		rule("─", "┌", "┬", "┐")
+		printRow(headers)
+		rule("─", "├", "┼", "┤")
+		for _, row := range data {
+			printRow(row)
+		}
+		rule("─", "└", "┴", "┘")
+		return
+	case styleMarkdown:
+		printRow(headers)
+		rule("-", "|", "|", "|")
+	case stylePlain:
+		printRow(headers)
+	default:
+		printRow(headers)
+		seps := make([]string, len(widths))
+		for i, w := range widths {
+			seps[i] = strings.Repeat("-", w)
+		}
+		fmt.Fprintln(output, strings.Join(seps, "-+-"))
+	}
+	for _, row := range data {
+		printRow(row)
+	}
+}
+
+func truncateCell(s string) string {
+	s = strings.ReplaceAll(s, "\n", " ")
+	if utf8.RuneCountInString(s) <= maxCellWidth {
+		return s
+	}
+	r := []rune(s)
+	return string(r[:maxCellWidth-1]) + "…"
+}
+
+// --- Table previews ---
+
+// runPeek prints the first rows of a public table. The name must match an
+// existing table before it is spliced into SQL, and is quoted regardless.
+func runPeek(db *sql.DB, args []string) {
+	args, limitStr, hasLimit := popValue(args, "--limit")
+	if len(args) != 1 {
+		fmt.Fprintln(stdout, "{⚠️  } Usage: hvmd peek <table> [--limit n] --core")
+		exit(1)
+	}
+	table := args[0]
+
+	limit := 10
+	if hasLimit {
+		n, err := strconv.Atoi(limitStr)
+		if err != nil || n <= 0 {
+			fmt.Fprintln(stdout, "{⚠️  } --limit expects a positive number")
+			exit(1)
+		}
+		limit = n
+	}
+
+	tables, err := listTables(db, func(string) bool { return true })
+	if err != nil {
+		fmt.Fprintf(stdout, "{⚠️  } Failed to fetch tables: %s\n", describeQueryErr(err))
+		exit(1)
+	}
+	if !slices.Contains(tables, table) {
+		fmt.Fprintf(stdout, "{⚠️  } No such table in public schema: %s\n", table)
+		exit(1)
+	}
+
+	ctx, cancel := queryContext()
+	defer cancel()
+
+	query := fmt.Sprintf("SELECT * FROM %s.%s LIMIT $1;", pq.QuoteIdentifier("public"), pq.QuoteIdentifier(table))
+	rows, err := db.QueryContext(ctx, query, limit)
+	if err != nil {
+		fmt.Fprintf(stdout, "{⚠️  } Query failed: %s\n", describeQueryErr(err))
+		exit(1)
+	}
+	defer rows.Close()
+
+	headers, data, err := readRows(rows)
+	if err != nil {
+		fmt.Fprintf(stdout, "{⚠️  } Failed to read results: %s\n", describeQueryErr(err))
+		exit(1)
+	}
+
+	renderTable(headers, data)
+	fmt.Fprintf(output, "(%d row(s))\n", len(data))
+	if len(data) == 0 {
+		exitIfEmpty()
+	}
+}
+
+// --- Table dumps ---
+
+// runDump streams a public table into a CSV file with a header row. NULLs
+// are written as empty fields unless --null gives a sentinel.
+func runDump(db *sql.DB, args []string) {
+	args, nullValue, _ := popValue(args, "--null")
+	if len(args) != 2 {
+		fmt.Fprintln(stdout, "{⚠️  } Usage: hvmd dump <table> <file.csv> [--null <text>] --core")
+		exit(1)
+	}
+	table, path := args[0], args[1]
+
+	tables, err := listTables(db, func(string) bool { return true })
+	if err != nil {
+		fmt.Fprintf(stdout, "{⚠️  } Failed to fetch tables: %s\n", describeQueryErr(err))
+		exit(1)
+	}
+	if !slices.Contains(tables, table) {
+		fmt.Fprintf(stdout, "{⚠️  } No such table in public schema: %s\n", table)
+		exit(1)
+	}
+
+	// No --timeout here: a dump runs as long as the table takes, but Ctrl-C
+	// still cancels it.
+	rows, err := db.QueryContext(interruptCtx, fmt.Sprintf("SELECT * FROM %s.%s;", pq.QuoteIdentifier("public"), pq.QuoteIdentifier(table)))
+	if err != nil {
+		fmt.Fprintf(stdout, "{⚠️  } Query failed: %v\n", err)
+		exit(1)
+	}
+	defer rows.Close()
+
+	headers, err := rows.Columns()
+	if err != nil {
+		fmt.Fprintf(stdout, "{⚠️  } Failed to read columns: %v\n", err)
+		exit(1)
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		fmt.Fprintf(stdout, "{⚠️  } Failed to create %s: %v\n", path, err)
+		exit(1)
+	}
+	defer f.Close()
+
+	w := csv.NewWriter(f)
+	w.Write(headers)
+
+	values := make([]interface{}, len(headers))
+	ptrs := make([]interface{}, len(headers))
+	for i := range values {
+		ptrs[i] = &values[i]
+	}
+	record := make([]string, len(headers))
+
+	n := 0
+	for rows.Next() {
+		if err := rows.Scan(ptrs...); err != nil {
+			fmt.Fprintf(stdout, "{⚠️  } Failed to read row %d: %v\n", n+1, err)
+			exit(1)
+		}
+		for i, v := range values {
+			switch v := v.(type) {
+			case nil:
+				record[i] = nullValue
+			case time.Time:
+				// formatValue's short form drops fractions and zones; a dump
+				// keeps them so the file loads back unchanged.
+				record[i] = v.Format(time.RFC3339Nano)
+			default:
+				record[i] = formatValue(v)
+			}
+		}
+		if err := w.Write(record); err != nil {
+			fmt.Fprintf(stdout, "{⚠️  } Failed to write %s: %v\n", path, err)
+			exit(1)
+		}
+		n++
+	}
+	if err := rows.Err(); err != nil {
+		fmt.Fprintf(stdout, "{⚠️  } Failed to read rows: %v\n", err)
+		exit(1)
+	}
+
+	w.Flush()
+	if err := w.Error(); err != nil {
+		fmt.Fprintf(stdout, "{⚠️  } Failed to write %s: %v\n", path, err)
+		exit(1)
+	}
+	fmt.Fprintf(stdout, "{💾 } Wrote %d row(s) from %s to %s\n", n, table, path)
+}
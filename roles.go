@@ -0,0 +1,522 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// --- Role export ---
+func runExportRoles(db *sql.DB, args []string, username string) {
+	_, withPasswords := popFlag(args, "--with-passwords")
+
+	if withPasswords {
+		me, err := scanRoleAttrs(db.QueryRow(roleAttrsQuery+`WHERE rolname = $1`, username))
+		if err != nil || !me.rolsuper {
+			fmt.Fprintln(stdout, "{⚠️  } --with-passwords requires a superuser connection")
+			exit(1)
+		}
+	}
+
+	rows, err := db.Query(roleAttrsQuery + `
+		WHERE rolname !~ '^pg_'
+		ORDER BY rolname
+	`)
+	if err != nil {
+		fmt.Fprintf(stdout, "{⚠️  } Failed to read roles: %v\n", err)
+		return
+	}
+	defer rows.Close()
+
+	var roles []roleAttrs
+	for rows.Next() {
+		r, err := scanRoleAttrs(rows)
+		if err != nil {
+			fmt.Fprintf(stdout, "{⚠️  } Failed to read role: %v\n", err)
+			continue
+		}
+		roles = append(roles, r)
+	}
+
+	// pg_roles always masks the password; the hash lives in pg_authid,
+	// which only superusers can read.
+	passwords := map[string]string{}
+	if withPasswords {
+		pwRows, err := db.Query(`
+			SELECT rolname, rolpassword
+			FROM pg_authid
+			WHERE rolpassword IS NOT NULL
+		`)
+		if err != nil {
+			fmt.Fprintf(stdout, "{⚠️  } Failed to read password hashes: %v\n", err)
+			return
+		}
+		for pwRows.Next() {
+			var name, hash string
+			if err := pwRows.Scan(&name, &hash); err != nil {
+				continue
+			}
+			passwords[name] = hash
+		}
+		pwRows.Close()
+	}
+
+	fmt.Fprintln(output, "-- Roles exported by hvmd")
+	for _, r := range roles {
+		stmt := fmt.Sprintf("CREATE ROLE %s WITH %s", pq.QuoteIdentifier(r.rolname), roleOptions(r))
+		if hash, ok := passwords[r.rolname]; ok {
+			stmt += " PASSWORD " + pq.QuoteLiteral(hash)
+		}
+		fmt.Fprintln(output, stmt+";")
+	}
+
+	memberRows, err := db.Query(`
+		SELECT g.rolname, m.rolname, am.admin_option
+		FROM pg_auth_members am
+		JOIN pg_roles g ON g.oid = am.roleid
+		JOIN pg_roles m ON m.oid = am.member
+		WHERE g.rolname !~ '^pg_' OR m.rolname !~ '^pg_'
+		ORDER BY 1, 2;
+	`)
+	if err != nil {
+		fmt.Fprintf(stdout, "{⚠️  } Failed to read role memberships: %v\n", err)
+		return
+	}
+	defer memberRows.Close()
+
+	fmt.Fprintln(output, "")
+	fmt.Fprintln(output, "-- Memberships")
+	for memberRows.Next() {
+		var group, member string
+		var admin bool
+		if err := memberRows.Scan(&group, &member, &admin); err != nil {
+			continue
+		}
+		stmt := fmt.Sprintf("GRANT %s TO %s", pq.QuoteIdentifier(group), pq.QuoteIdentifier(member))
+		if admin {
+			stmt += " WITH ADMIN OPTION"
+		}
+		fmt.Fprintln(output, stmt+";")
+	}
+}
+
+// runBackupRoles writes a CREATE ROLE / ALTER ROLE pair per role to a file.
+// The ALTER carries the attributes, so replaying the file also brings roles
+// that already exist back in line. Passwords are never written.
+func runBackupRoles(db *sql.DB, args []string) {
+	if len(args) != 1 {
+		fmt.Fprintln(stdout, "{⚠️  } Usage: hvmd backup-roles <file> --core")
+		exit(1)
+	}
+	path := args[0]
+
+	rows, err := db.Query(roleAttrsQuery + `
+		WHERE rolname !~ '^pg_'
+		ORDER BY rolname
+	`)
+	if err != nil {
+		fmt.Fprintf(stdout, "{⚠️  } Failed to read roles: %v\n", err)
+		exit(1)
+	}
+	defer rows.Close()
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "-- Roles backed up by hvmd on %s (passwords not included)\n", time.Now().Format(time.RFC3339))
+	n := 0
+	for rows.Next() {
+		r, err := scanRoleAttrs(rows)
+		if err != nil {
+			fmt.Fprintf(stdout, "{⚠️  } Failed to read role: %v\n", err)
+			exit(1)
+		}
+		name := pq.QuoteIdentifier(r.rolname)
+		fmt.Fprintf(&b, "\nCREATE ROLE %s;\n", name)
+		fmt.Fprintf(&b, "ALTER ROLE %s WITH %s;\n", name, roleOptions(r))
+		n++
+	}
+	if err := rows.Err(); err != nil {
+		fmt.Fprintf(stdout, "{⚠️  } Failed to read roles: %v\n", err)
+		exit(1)
+	}
+
+	if err := os.WriteFile(path, []byte(b.String()), 0600); err != nil {
+		fmt.Fprintf(stdout, "{⚠️  } Failed to write %s: %v\n", path, err)
+		exit(1)
+	}
+	fmt.Fprintf(stdout, "{💾 } Exported %d role(s) to %s\n", n, path)
+}
+
+// --- Table grants ---
+
+// showGrants lists the privileges granted on one public table, or with no
+// argument summarizes the grantees of every public table.
+func showGrants(db *sql.DB, args []string) {
+	if len(args) > 1 {
+		fmt.Fprintln(stdout, "{⚠️  } Usage: hvmd grants [table] --core")
+		exit(1)
+	}
+
+	var query string
+	var queryArgs []interface{}
+	var headers []string
+	if len(args) == 1 {
+		table := args[0]
+		tables, err := listTables(db, func(string) bool { return true })
+		if err != nil {
+			fmt.Fprintf(stdout, "{⚠️  } Failed to fetch tables: %s\n", describeQueryErr(err))
+			exit(1)
+		}
+		if !slices.Contains(tables, table) {
+			fmt.Fprintf(stdout, "{⚠️  } No such table: %s\n", table)
+			exit(1)
+		}
+
+		query = `
+			SELECT grantee, privilege_type, is_grantable
+			FROM information_schema.role_table_grants
+			WHERE table_schema = 'public' AND table_name = $1
+			ORDER BY grantee, privilege_type;
+		`
+		queryArgs = []interface{}{table}
+		headers = []string{"grantee", "privilege", "grantable"}
+	} else {
+		query = `
+			SELECT table_name, count(DISTINCT grantee)::text, string_agg(DISTINCT grantee, ', ')
+			FROM information_schema.role_table_grants
+			WHERE table_schema = 'public'
+			GROUP BY table_name
+			ORDER BY table_name;
+		`
+		headers = []string{"table", "grantees", "roles"}
+	}
+
+	rows, err := db.Query(query, queryArgs...)
+	if err != nil {
+		fmt.Fprintf(stdout, "{⚠️  } Failed to read grants: %v\n", err)
+		exit(1)
+	}
+	defer rows.Close()
+
+	var data [][]string
+	for rows.Next() {
+		var a, b, c string
+		if err := rows.Scan(&a, &b, &c); err != nil {
+			fmt.Fprintf(stdout, "{⚠️  } Failed to read grant: %v\n", err)
+			continue
+		}
+		data = append(data, []string{a, b, c})
+	}
+
+	if len(data) == 0 {
+		fmt.Fprintln(stdout, "{⚠️  } No grants found")
+		exitIfEmpty()
+		return
+	}
+	renderTable(headers, data)
+}
+
+// roleOptions renders the attribute list of a CREATE/ALTER ROLE statement.
+func roleOptions(r roleAttrs) string {
+	flag := func(on bool, name string) string {
+		if on {
+			return name
+		}
+		return "NO" + name
+	}
+
+	opts := []string{
+		flag(r.rolcanlogin, "LOGIN"),
+		flag(r.rolsuper, "SUPERUSER"),
+		flag(r.rolinherit, "INHERIT"),
+		flag(r.rolcreaterole, "CREATEROLE"),
+		flag(r.rolcreatedb, "CREATEDB"),
+		flag(r.rolreplication, "REPLICATION"),
+		fmt.Sprintf("CONNECTION LIMIT %d", r.rolconnlimit),
+	}
+	if r.rolvaliduntil.Valid {
+		opts = append(opts, "VALID UNTIL "+pq.QuoteLiteral(r.rolvaliduntil.Time.Format("2006-01-02 15:04:05-07")))
+	}
+	return strings.Join(opts, " ")
+}
+
+// --- Connection limits ---
+func runSetConnLimit(db *sql.DB, args []string) {
+	args, dryRun := popFlag(args, "--dry-run")
+	if len(args) != 2 {
+		fmt.Fprintln(stdout, "{⚠️  } Usage: hvmd set-connlimit <role> <n> --core")
+		exit(1)
+	}
+
+	role := args[0]
+	limit, err := strconv.Atoi(args[1])
+	if err != nil || limit < -1 {
+		fmt.Fprintln(stdout, "{⚠️  } Limit must be a non-negative integer, or -1 for unlimited")
+		exit(1)
+	}
+
+	before, err := scanRoleAttrs(db.QueryRow(roleAttrsQuery+`WHERE rolname = $1`, role))
+	if err == sql.ErrNoRows {
+		fmt.Fprintf(stdout, "{⚠️  } Role not found: %s\n", role)
+		exit(1)
+	}
+	if err != nil {
+		fmt.Fprintf(stdout, "{⚠️  } Failed to read role %s: %v\n", role, err)
+		exit(1)
+	}
+
+	stmt := fmt.Sprintf("ALTER ROLE %s CONNECTION LIMIT %d", pq.QuoteIdentifier(role), limit)
+	fmt.Fprintf(stdout, "{🔢 } %s: %s -> %s\n", role, formatConnLimit(before.rolconnlimit), formatConnLimit(limit))
+
+	if dryRun {
+		fmt.Fprintf(stdout, "{🧪 } Dry run, would execute: %s;\n", stmt)
+		return
+	}
+
+	if _, err := db.Exec(stmt); err != nil {
+		fmt.Fprintf(stdout, "{⚠️  } Failed to set connection limit: %v\n", err)
+		exit(1)
+	}
+	fmt.Fprintln(stdout, "{✅ } Connection limit updated")
+}
+
+func formatConnLimit(n int) string {
+	if n < 0 {
+		return "unlimited"
+	}
+	return strconv.Itoa(n)
+}
+
+// --- Delegated core access ---
+
+// coreUsersTable is the delegated core allowlist. It lives in its own schema
+// and is always schema-qualified, so a table of the same name that some
+// other role creates earlier on the search_path is never consulted.
+const coreUsersTable = "hvmd.core_users"
+
+// coreAllowlistState reports whether the allowlist exists and whether both
+// its schema and the table are owned by a superuser. Anything else could
+// have been planted by an ordinary role and must not grant core access.
+func coreAllowlistState(db *sql.DB) (exists, trusted bool, err error) {
+	err = db.QueryRow(`
+		SELECT c.oid IS NOT NULL, coalesce(so.rolsuper AND tod.rolsuper, false)
+		FROM pg_catalog.pg_namespace n
+		JOIN pg_catalog.pg_roles so ON so.oid = n.nspowner
+		LEFT JOIN pg_catalog.pg_class c
+			ON c.relnamespace = n.oid AND c.relname = 'core_users' AND c.relkind = 'r'
+		LEFT JOIN pg_catalog.pg_roles tod ON tod.oid = c.relowner
+		WHERE n.nspname = 'hvmd'
+	`).Scan(&exists, &trusted)
+	if err == sql.ErrNoRows {
+		return false, false, nil
+	}
+	return exists, exists && trusted, err
+}
+
+// isMissingAllowlist reports whether err means the hvmd schema or the
+// allowlist table hasn't been created yet.
+func isMissingAllowlist(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && (pqErr.Code == "42P01" || pqErr.Code == "3F000")
+}
+
+func runGrantCore(db *sql.DB, args []string) {
+	if len(args) != 1 {
+		fmt.Fprintln(stdout, "{⚠️  } Usage: hvmd grant-core <role> --core")
+		exit(1)
+	}
+	role := args[0]
+
+	var exists bool
+	if err := db.QueryRow(`SELECT EXISTS (SELECT 1 FROM pg_roles WHERE rolname = $1)`, role).Scan(&exists); err != nil {
+		fmt.Fprintf(stdout, "{⚠️  } Failed to look up role: %v\n", err)
+		exit(1)
+	}
+	if !exists {
+		fmt.Fprintf(stdout, "{⚠️  } Role not found: %s\n", role)
+		exit(1)
+	}
+
+	var isSuper bool
+	if err := db.QueryRow(`SELECT rolsuper FROM pg_catalog.pg_roles WHERE rolname = current_user`).Scan(&isSuper); err != nil {
+		fmt.Fprintf(stdout, "{⚠️  } Failed to look up current role: %v\n", err)
+		exit(1)
+	}
+	if !isSuper {
+		fmt.Fprintln(stdout, "{⚠️  } grant-core requires a superuser connection")
+		exit(1)
+	}
+
+	_, err := db.Exec(`
+		CREATE SCHEMA IF NOT EXISTS hvmd;
+		REVOKE ALL ON SCHEMA hvmd FROM PUBLIC;
+		CREATE TABLE IF NOT EXISTS ` + coreUsersTable + ` (
+			rolname    text PRIMARY KEY,
+			granted_by text NOT NULL DEFAULT current_user,
+			granted_at timestamptz NOT NULL DEFAULT now()
+		);
+		REVOKE ALL ON ` + coreUsersTable + ` FROM PUBLIC;
+	`)
+	if err != nil {
+		fmt.Fprintf(stdout, "{⚠️  } Failed to create %s: %v\n", coreUsersTable, err)
+		exit(1)
+	}
+
+	// IF NOT EXISTS keeps whatever was there before; make sure it's ours.
+	if _, trusted, err := coreAllowlistState(db); err != nil || !trusted {
+		fmt.Fprintf(stdout, "{⚠️  } Refusing to use %s: it or its schema is not owned by a superuser\n", coreUsersTable)
+		exit(1)
+	}
+
+	res, err := db.Exec(`INSERT INTO `+coreUsersTable+` (rolname) VALUES ($1) ON CONFLICT DO NOTHING`, role)
+	if err != nil {
+		fmt.Fprintf(stdout, "{⚠️  } Failed to grant core access: %v\n", err)
+		exit(1)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		fmt.Fprintf(stdout, "{👁️  } %s already has core access\n", role)
+		return
+	}
+	invalidateCoreAccess()
+	fmt.Fprintf(stdout, "{✅ } Core access granted to %s\n", role)
+}
+
+func runRevokeCore(db *sql.DB, args []string) {
+	if len(args) != 1 {
+		fmt.Fprintln(stdout, "{⚠️  } Usage: hvmd revoke-core <role> --core")
+		exit(1)
+	}
+	role := args[0]
+
+	res, err := db.Exec(`DELETE FROM `+coreUsersTable+` WHERE rolname = $1`, role)
+	if isMissingAllowlist(err) {
+		fmt.Fprintf(stdout, "{👁️  } %s had no delegated core access\n", role)
+		return
+	}
+	if err != nil {
+		fmt.Fprintf(stdout, "{⚠️  } Failed to revoke core access: %v\n", err)
+		exit(1)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		fmt.Fprintf(stdout, "{👁️  } %s had no delegated core access\n", role)
+		return
+	}
+	invalidateCoreAccess()
+	fmt.Fprintf(stdout, "{✅ } Core access revoked from %s\n", role)
+}
+
+func showCoreUsers(db *sql.DB) {
+	rows, err := db.Query(`
+		SELECT rolname, granted_by, granted_at
+		FROM ` + coreUsersTable + `
+		ORDER BY rolname
+	`)
+	if isMissingAllowlist(err) {
+		fmt.Fprintln(stdout, "{👁️  } No delegated core users (superusers always have core access)")
+		exitIfEmpty()
+		return
+	}
+	if err != nil {
+		fmt.Fprintf(stdout, "{⚠️  } Failed to read core users: %v\n", err)
+		exit(1)
+	}
+	defer rows.Close()
+
+	count := 0
+	for rows.Next() {
+		var name, grantedBy string
+		var grantedAt time.Time
+		if err := rows.Scan(&name, &grantedBy, &grantedAt); err != nil {
+			continue
+		}
+		if count == 0 {
+			fmt.Fprintln(output, "{👁️  } Delegated core users:")
+		}
+		count++
+		fmt.Fprintf(output, "    🔑  %s | granted by %s at %s\n", name, grantedBy, grantedAt.Format("2006-01-02 15:04:05"))
+	}
+
+	if count == 0 {
+		fmt.Fprintln(stdout, "{👁️  } No delegated core users (superusers always have core access)")
+		exitIfEmpty()
+	}
+}
+
+// --- Role membership tree ---
+
+// showRolesTree prints every group role with its members indented below it,
+// recursing into members that are groups themselves. Postgres refuses
+// circular grants, but a cycle is still cut off rather than followed.
+func showRolesTree(db *sql.DB) {
+	rows, err := db.Query(`
+		SELECT g.rolname, m.rolname
+		FROM pg_auth_members am
+		JOIN pg_roles g ON g.oid = am.roleid
+		JOIN pg_roles m ON m.oid = am.member
+		ORDER BY g.rolname, m.rolname
+	`)
+	if err != nil {
+		fmt.Fprintf(stdout, "{⚠️  } Failed to read role memberships: %v\n", err)
+		exit(1)
+	}
+	defer rows.Close()
+
+	members := map[string][]string{}
+	isMember := map[string]bool{}
+	var groups []string
+	for rows.Next() {
+		var group, member string
+		if err := rows.Scan(&group, &member); err != nil {
+			fmt.Fprintf(stdout, "{⚠️  } Failed to read membership: %v\n", err)
+			continue
+		}
+		if _, seen := members[group]; !seen {
+			groups = append(groups, group)
+		}
+		members[group] = append(members[group], member)
+		isMember[member] = true
+	}
+
+	if len(groups) == 0 {
+		fmt.Fprintln(stdout, "{👁️  } No role memberships found")
+		exitIfEmpty()
+		return
+	}
+
+	printed := map[string]bool{}
+	var walk func(role string, depth int, path []string)
+	walk = func(role string, depth int, path []string) {
+		indent := strings.Repeat("    ", depth)
+		if slices.Contains(path, role) {
+			fmt.Fprintf(output, "%s└─ %s (cycle)\n", indent, role)
+			return
+		}
+		printed[role] = true
+		if depth == 0 {
+			fmt.Fprintf(output, "👥 %s\n", role)
+		} else {
+			fmt.Fprintf(output, "%s└─ %s\n", indent, role)
+		}
+		for _, m := range members[role] {
+			walk(m, depth+1, append(path, role))
+		}
+	}
+
+	// Top-level groups first; anything left over only hangs off a cycle.
+	for _, g := range groups {
+		if !isMember[g] {
+			walk(g, 0, nil)
+		}
+	}
+	for _, g := range groups {
+		if !printed[g] {
+			walk(g, 0, nil)
+		}
+	}
+}
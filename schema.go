@@ -0,0 +1,875 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// --- Functions ---
+func showFunctions(db *sql.DB, args []string) {
+	args, defName, wantDef := popValue(args, "--definition")
+
+	schema := "public"
+	if len(args) > 0 {
+		schema = args[0]
+	}
+
+	if wantDef {
+		if !coreEnabled {
+			fmt.Fprintln(stdout, "(!) --definition requires --core")
+			exit(1)
+		}
+		showFunctionDef(db, schema, defName)
+		return
+	}
+
+	rows, err := db.Query(`
+		SELECT
+			p.proname,
+			pg_get_function_arguments(p.oid),
+			coalesce(pg_get_function_result(p.oid), ''),
+			l.lanname
+		FROM pg_proc p
+		JOIN pg_namespace n ON n.oid = p.pronamespace
+		JOIN pg_language l ON l.oid = p.prolang
+		WHERE n.nspname = $1
+		ORDER BY 1, 2;
+	`, schema)
+	if err != nil {
+		fmt.Fprintf(stdout, "(X) Failed to query functions: %v\n", err)
+		exit(1)
+	}
+	defer rows.Close()
+
+	count := 0
+	for rows.Next() {
+		var name, fnArgs, result, lang string
+		if err := rows.Scan(&name, &fnArgs, &result, &lang); err != nil {
+			fmt.Fprintf(stdout, "(!) Failed to read row: %v\n", err)
+			continue
+		}
+		if count == 0 {
+			fmt.Fprintf(output, "(✓) Functions in %s:\n", schema)
+		}
+		count++
+		if result == "" {
+			fmt.Fprintf(output, "  (-) %s(%s) [%s]\n", name, fnArgs, lang)
+			continue
+		}
+		fmt.Fprintf(output, "  (-) %s(%s) -> %s [%s]\n", name, fnArgs, result, lang)
+	}
+
+	if count == 0 {
+		fmt.Fprintf(stdout, "(!) No functions found in %s\n", schema)
+		exitIfEmpty()
+	}
+}
+
+func showFunctionDef(db *sql.DB, schema, name string) {
+	// Aggregates and window functions have no CREATE FUNCTION form.
+	rows, err := db.Query(`
+		SELECT pg_get_functiondef(p.oid)
+		FROM pg_proc p
+		JOIN pg_namespace n ON n.oid = p.pronamespace
+		WHERE n.nspname = $1 AND p.proname = $2 AND p.prokind IN ('f', 'p')
+		ORDER BY pg_get_function_arguments(p.oid);
+	`, schema, name)
+	if err != nil {
+		fmt.Fprintf(stdout, "{⚠️  } Failed to read definition: %v\n", err)
+		exit(1)
+	}
+	defer rows.Close()
+
+	found := false
+	for rows.Next() {
+		var def string
+		if err := rows.Scan(&def); err != nil {
+			fmt.Fprintf(stdout, "{⚠️  } Failed to read definition: %v\n", err)
+			continue
+		}
+		found = true
+		fmt.Fprintln(output, def)
+	}
+
+	if !found {
+		fmt.Fprintf(stdout, "{⚠️  } No function %s.%s found\n", schema, name)
+		exit(1)
+	}
+}
+
+// --- Views ---
+func showViews(db *sql.DB, args []string) {
+	args, defName, wantDef := popValue(args, "--definition")
+
+	schema := "public"
+	if len(args) > 0 {
+		schema = args[0]
+	}
+
+	if wantDef {
+		showViewDef(db, schema, defName)
+		return
+	}
+
+	// information_schema.views leaves out materialized views.
+	rows, err := db.Query(`
+		SELECT table_name, 'view'
+		FROM information_schema.views
+		WHERE table_schema = $1
+		UNION ALL
+		SELECT matviewname, 'materialized view'
+		FROM pg_matviews
+		WHERE schemaname = $1
+		ORDER BY 1;
+	`, schema)
+	if err != nil {
+		fmt.Fprintf(stdout, "(X) Failed to query views: %v\n", err)
+		exit(1)
+	}
+	defer rows.Close()
+
+	count := 0
+	for rows.Next() {
+		var name, kind string
+		if err := rows.Scan(&name, &kind); err != nil {
+			fmt.Fprintf(stdout, "(!) Failed to read row: %v\n", err)
+			continue
+		}
+		if count == 0 {
+			fmt.Fprintf(output, "(✓) Views in %s:\n", schema)
+		}
+		count++
+		fmt.Fprintf(output, "  (-) %s [%s]\n", name, kind)
+	}
+
+	if count == 0 {
+		fmt.Fprintf(stdout, "(!) No views found in %s\n", schema)
+		exitIfEmpty()
+	}
+}
+
+func showViewDef(db *sql.DB, schema, name string) {
+	var kind, def string
+	err := db.QueryRow(`
+		SELECT c.relkind::text, pg_get_viewdef(c.oid, true)
+		FROM pg_class c
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		WHERE n.nspname = $1 AND c.relname = $2 AND c.relkind IN ('v', 'm');
+	`, schema, name).Scan(&kind, &def)
+	if err == sql.ErrNoRows {
+		fmt.Fprintf(stdout, "(!) No view %s.%s found\n", schema, name)
+		exit(1)
+	}
+	if err != nil {
+		fmt.Fprintf(stdout, "(X) Failed to read view definition: %v\n", err)
+		exit(1)
+	}
+
+	label := "view"
+	if kind == "m" {
+		label = "materialized view"
+	}
+	fmt.Fprintf(output, "(✓) %s.%s [%s]:\n", schema, name, label)
+	fmt.Fprintln(output, def)
+}
+
+// --- JSON schema output ---
+type columnInfo struct {
+	Name       string `json:"name"`
+	DataType   string `json:"data_type"`
+	IsNullable string `json:"is_nullable"`
+}
+
+type tableInfo struct {
+	Name    string       `json:"name"`
+	Columns []columnInfo `json:"columns"`
+}
+
+type schemaDoc struct {
+	Tables     []tableInfo `json:"tables"`
+	AdminUsers []string    `json:"admin_users,omitempty"`
+}
+
+// emitSchema is the csv and json form of readdb. Failures go to stderr so
+// stdout only ever carries a parseable document. CSV has one row per column
+// and leaves out the admin list.
+func emitSchema(db *sql.DB, match func(string) bool, withAdmins bool, f outputFormat) {
+	tables, err := readSchema(db, match)
+	if err != nil {
+		fmt.Fprintf(stderr, "(!) Failed to fetch tables: %v\n", err)
+		exit(1)
+	}
+	doc := schemaDoc{Tables: tables}
+
+	if f == formatCSV {
+		var data [][]string
+		for _, t := range doc.Tables {
+			for _, c := range t.Columns {
+				data = append(data, []string{t.Name, c.Name, c.DataType, c.IsNullable})
+			}
+		}
+		emitRows(f, []string{"table", "column", "data_type", "is_nullable"}, data)
+		if len(doc.Tables) == 0 {
+			exitIfEmpty()
+		}
+		return
+	}
+
+	if withAdmins {
+		adminRows, err := db.Query(`
+			SELECT rolname
+			FROM pg_roles
+			WHERE rolsuper = true OR rolcreaterole = true
+			ORDER BY rolname;
+		`)
+		if err != nil {
+			fmt.Fprintf(stderr, "(!) Failed to read admin users: %v\n", err)
+			exit(1)
+		}
+		defer adminRows.Close()
+
+		doc.AdminUsers = []string{}
+		for adminRows.Next() {
+			var a string
+			if err := adminRows.Scan(&a); err != nil {
+				continue
+			}
+			doc.AdminUsers = append(doc.AdminUsers, a)
+		}
+	}
+
+	emitJSON(doc)
+
+	if len(doc.Tables) == 0 {
+		exitIfEmpty()
+	}
+}
+
+// readSchema returns the public tables accepted by match with their columns
+// in ordinal order.
+func readSchema(db *sql.DB, match func(string) bool) ([]tableInfo, error) {
+	ctx, cancel := queryContext()
+	defer cancel()
+
+	rows, err := db.QueryContext(ctx, `
+		SELECT t.table_name, c.column_name, c.data_type, c.is_nullable
+		FROM information_schema.tables t
+		LEFT JOIN information_schema.columns c
+			ON c.table_schema = t.table_schema AND c.table_name = t.table_name
+		WHERE t.table_schema = 'public'
+		ORDER BY t.table_name, c.ordinal_position;
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tables := []tableInfo{}
+	for rows.Next() {
+		var table string
+		var col, dataType, nullable sql.NullString
+		if err := rows.Scan(&table, &col, &dataType, &nullable); err != nil {
+			return nil, err
+		}
+		if !match(table) {
+			continue
+		}
+		if n := len(tables); n == 0 || tables[n-1].Name != table {
+			tables = append(tables, tableInfo{Name: table, Columns: []columnInfo{}})
+		}
+		if col.Valid {
+			t := &tables[len(tables)-1]
+			t.Columns = append(t.Columns, columnInfo{col.String, dataType.String, nullable.String})
+		}
+	}
+	return tables, rows.Err()
+}
+
+// --- Schema diff ---
+
+// runSchemaDiff compares the public tables and columns of two profiles and
+// prints what exists on one side only or differs in type or nullability.
+func runSchemaDiff(args []string) {
+	args, nameA, hasA := popValue(args, "--profile-a")
+	_, nameB, hasB := popValue(args, "--profile-b")
+	if !hasA || !hasB {
+		fmt.Fprintln(stdout, "{⚠️  } Usage: hvmd schema-diff --profile-a <name> --profile-b <name> --core")
+		exit(1)
+	}
+
+	infof("{🔎 } Comparing schema of %s (a) with %s (b)...", nameA, nameB)
+	a := profileSchema(nameA)
+	b := profileSchema(nameB)
+
+	columnsOf := func(t tableInfo) map[string]columnInfo {
+		m := make(map[string]columnInfo, len(t.Columns))
+		for _, c := range t.Columns {
+			m[c.Name] = c
+		}
+		return m
+	}
+	describe := func(c columnInfo) string {
+		if c.IsNullable == "YES" {
+			return c.DataType + " null"
+		}
+		return c.DataType + " not null"
+	}
+
+	diffs := 0
+	line := func(format string, v ...interface{}) {
+		diffs++
+		noteWarning()
+		fmt.Fprintf(output, "  "+format+"\n", v...)
+	}
+
+	names := map[string]bool{}
+	for name := range a {
+		names[name] = true
+	}
+	for name := range b {
+		names[name] = true
+	}
+	sorted := make([]string, 0, len(names))
+	for name := range names {
+		sorted = append(sorted, name)
+	}
+	sort.Strings(sorted)
+
+	for _, name := range sorted {
+		ta, inA := a[name]
+		tb, inB := b[name]
+		switch {
+		case !inB:
+			line("< table %s", name)
+			continue
+		case !inA:
+			line("> table %s", name)
+			continue
+		}
+
+		colsB := columnsOf(tb)
+		for _, ca := range ta.Columns {
+			cb, ok := colsB[ca.Name]
+			switch {
+			case !ok:
+				line("< column %s.%s (%s)", name, ca.Name, describe(ca))
+			case ca != cb:
+				line("~ column %s.%s: %s (a) vs %s (b)", name, ca.Name, describe(ca), describe(cb))
+			}
+		}
+		colsA := columnsOf(ta)
+		for _, cb := range tb.Columns {
+			if _, ok := colsA[cb.Name]; !ok {
+				line("> column %s.%s (%s)", name, cb.Name, describe(cb))
+			}
+		}
+	}
+
+	if diffs == 0 {
+		fmt.Fprintln(stdout, "{✅ } Schemas match")
+		return
+	}
+	fmt.Fprintf(stdout, "\n{⚠️  } %d difference(s); < only in %s, > only in %s, ~ changed\n", diffs, nameA, nameB)
+}
+
+// profileSchema connects with the named profile and reads its public tables,
+// keyed by name.
+func profileSchema(name string) map[string]tableInfo {
+	db := openProfile(name)
+	defer db.Close()
+
+	tables, err := readSchema(db, func(string) bool { return true })
+	if err != nil {
+		fmt.Fprintf(stdout, "{⚠️  } Failed to read schema of %s: %v\n", name, err)
+		exit(1)
+	}
+	m := make(map[string]tableInfo, len(tables))
+	for _, t := range tables {
+		m[t.Name] = t
+	}
+	return m
+}
+
+// --- DDL export ---
+type ddlColumn struct {
+	name, dataType, nullable string
+	def                      sql.NullString
+}
+
+func runExportSchema(db *sql.DB, args []string) {
+	if len(args) != 1 {
+		fmt.Fprintln(stdout, "{⚠️  } Usage: hvmd export-schema <file> --core")
+		exit(1)
+	}
+	path := args[0]
+
+	rows, err := db.Query(`
+		SELECT c.table_name, c.column_name, format_type(a.atttypid, a.atttypmod), c.is_nullable, c.column_default
+		FROM information_schema.columns c
+		JOIN information_schema.tables t
+			ON t.table_schema = c.table_schema AND t.table_name = c.table_name
+		JOIN pg_attribute a
+			ON a.attrelid = format('%I.%I', c.table_schema, c.table_name)::regclass
+			AND a.attname = c.column_name
+		WHERE c.table_schema = 'public' AND t.table_type = 'BASE TABLE'
+		ORDER BY c.table_name, c.ordinal_position;
+	`)
+	if err != nil {
+		fmt.Fprintf(stdout, "{⚠️  } Failed to read columns: %v\n", err)
+		exit(1)
+	}
+	defer rows.Close()
+
+	columns := map[string][]ddlColumn{}
+	var tables []string
+	for rows.Next() {
+		var table string
+		var col ddlColumn
+		if err := rows.Scan(&table, &col.name, &col.dataType, &col.nullable, &col.def); err != nil {
+			fmt.Fprintf(stdout, "{⚠️  } Failed to read column: %v\n", err)
+			continue
+		}
+		if _, seen := columns[table]; !seen {
+			tables = append(tables, table)
+		}
+		columns[table] = append(columns[table], col)
+	}
+
+	deps, err := foreignKeyDeps(db)
+	if err != nil {
+		fmt.Fprintf(stdout, "{⚠️  } Failed to read foreign keys, writing tables alphabetically: %v\n", err)
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "-- Schema exported by hvmd at %s\n", time.Now().Format("2006-01-02 15:04:05"))
+	for _, table := range dependencyOrder(tables, deps) {
+		fmt.Fprintf(&b, "\nCREATE TABLE %s.%s (\n", pq.QuoteIdentifier("public"), pq.QuoteIdentifier(table))
+		cols := columns[table]
+		for i, col := range cols {
+			line := fmt.Sprintf("    %s %s", pq.QuoteIdentifier(col.name), col.dataType)
+			if col.def.Valid {
+				line += " DEFAULT " + col.def.String
+			}
+			if col.nullable == "NO" {
+				line += " NOT NULL"
+			}
+			if i < len(cols)-1 {
+				line += ","
+			}
+			b.WriteString(line + "\n")
+		}
+		b.WriteString(");\n")
+	}
+
+	if err := os.WriteFile(path, []byte(b.String()), 0600); err != nil {
+		fmt.Fprintf(stdout, "{⚠️  } Failed to write %s: %v\n", path, err)
+		exit(1)
+	}
+	fmt.Fprintf(stdout, "{💾 } Wrote %d table(s) to %s\n", len(tables), path)
+}
+
+// foreignKeyDeps maps each public table to the public tables it references.
+func foreignKeyDeps(db *sql.DB) (map[string][]string, error) {
+	rows, err := db.Query(`
+		SELECT DISTINCT src.relname, dst.relname
+		FROM pg_constraint c
+		JOIN pg_class src ON src.oid = c.conrelid
+		JOIN pg_class dst ON dst.oid = c.confrelid
+		JOIN pg_namespace sn ON sn.oid = src.relnamespace
+		JOIN pg_namespace dn ON dn.oid = dst.relnamespace
+		WHERE c.contype = 'f' AND sn.nspname = 'public' AND dn.nspname = 'public';
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deps := map[string][]string{}
+	for rows.Next() {
+		var src, dst string
+		if err := rows.Scan(&src, &dst); err != nil {
+			return nil, err
+		}
+		if src != dst {
+			deps[src] = append(deps[src], dst)
+		}
+	}
+	return deps, rows.Err()
+}
+
+// dependencyOrder sorts tables so referenced tables come first. Tables caught
+// in a reference cycle are appended alphabetically at the end.
+func dependencyOrder(tables []string, deps map[string][]string) []string {
+	known := map[string]bool{}
+	for _, t := range tables {
+		known[t] = true
+	}
+
+	pending := map[string]int{}
+	dependents := map[string][]string{}
+	for _, t := range tables {
+		for _, d := range deps[t] {
+			if known[d] {
+				pending[t]++
+				dependents[d] = append(dependents[d], t)
+			}
+		}
+	}
+
+	var ready, ordered []string
+	for _, t := range tables {
+		if pending[t] == 0 {
+			ready = append(ready, t)
+		}
+	}
+	done := map[string]bool{}
+	for len(ready) > 0 {
+		sort.Strings(ready)
+		t := ready[0]
+		ready = ready[1:]
+		ordered = append(ordered, t)
+		done[t] = true
+		for _, dep := range dependents[t] {
+			if pending[dep]--; pending[dep] == 0 {
+				ready = append(ready, dep)
+			}
+		}
+	}
+
+	for _, t := range tables {
+		if !done[t] {
+			ordered = append(ordered, t)
+		}
+	}
+	return ordered
+}
+
+// --- Keys ---
+type foreignKey struct {
+	name, column, refTable, refColumn string
+}
+
+// primaryKeyColumns returns the set of primary key columns of a public table.
+func primaryKeyColumns(ctx context.Context, db *sql.DB, table string) (map[string]bool, error) {
+	rows, err := db.QueryContext(ctx, `
+		SELECT kcu.column_name
+		FROM information_schema.table_constraints tc
+		JOIN information_schema.key_column_usage kcu
+			ON kcu.constraint_schema = tc.constraint_schema
+			AND kcu.constraint_name = tc.constraint_name
+		WHERE tc.constraint_type = 'PRIMARY KEY'
+		  AND tc.table_schema = 'public'
+		  AND tc.table_name = $1;
+	`, table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	cols := map[string]bool{}
+	for rows.Next() {
+		var col string
+		if err := rows.Scan(&col); err != nil {
+			return nil, err
+		}
+		cols[col] = true
+	}
+	return cols, rows.Err()
+}
+
+// tableIndex is one row of pg_indexes.
+type tableIndex struct {
+	name, def string
+	unique    bool
+}
+
+// tableIndexes lists the indexes of a public table by name.
+func tableIndexes(ctx context.Context, db *sql.DB, table string) ([]tableIndex, error) {
+	rows, err := db.QueryContext(ctx, `
+		SELECT indexname, indexdef
+		FROM pg_indexes
+		WHERE schemaname = 'public' AND tablename = $1
+		ORDER BY indexname;
+	`, table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var idxs []tableIndex
+	for rows.Next() {
+		var idx tableIndex
+		if err := rows.Scan(&idx.name, &idx.def); err != nil {
+			return nil, err
+		}
+		idx.unique = strings.HasPrefix(idx.def, "CREATE UNIQUE INDEX")
+		idxs = append(idxs, idx)
+	}
+	return idxs, rows.Err()
+}
+
+// foreignKeys lists the outgoing foreign keys of a public table, one entry per
+// column, paired with the referenced column by position.
+func foreignKeys(ctx context.Context, db *sql.DB, table string) ([]foreignKey, error) {
+	rows, err := db.QueryContext(ctx, `
+		SELECT tc.constraint_name, kcu.column_name, ref.table_name, ref.column_name
+		FROM information_schema.table_constraints tc
+		JOIN information_schema.key_column_usage kcu
+			ON kcu.constraint_schema = tc.constraint_schema
+			AND kcu.constraint_name = tc.constraint_name
+		JOIN information_schema.referential_constraints rc
+			ON rc.constraint_schema = tc.constraint_schema
+			AND rc.constraint_name = tc.constraint_name
+		JOIN information_schema.key_column_usage ref
+			ON ref.constraint_schema = rc.unique_constraint_schema
+			AND ref.constraint_name = rc.unique_constraint_name
+			AND ref.ordinal_position = kcu.position_in_unique_constraint
+		WHERE tc.constraint_type = 'FOREIGN KEY'
+		  AND tc.table_schema = 'public'
+		  AND tc.table_name = $1
+		ORDER BY tc.constraint_name, kcu.ordinal_position;
+	`, table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var fks []foreignKey
+	for rows.Next() {
+		var fk foreignKey
+		if err := rows.Scan(&fk.name, &fk.column, &fk.refTable, &fk.refColumn); err != nil {
+			return nil, err
+		}
+		fks = append(fks, fk)
+	}
+	return fks, rows.Err()
+}
+
+// --- Disk usage ---
+func showSizes(db *sql.DB) {
+	var dbName, dbSize string
+	err := db.QueryRow(`
+		SELECT current_database(), pg_size_pretty(pg_database_size(current_database()));
+	`).Scan(&dbName, &dbSize)
+	if err != nil {
+		fmt.Fprintf(stdout, "{⚠️  } Failed to read database size: %v\n", err)
+		exit(1)
+	}
+
+	rows, err := db.Query(`
+		SELECT c.relname, pg_total_relation_size(c.oid), pg_size_pretty(pg_total_relation_size(c.oid))
+		FROM pg_class c
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		WHERE n.nspname = 'public' AND c.relkind IN ('r', 'p', 'm')
+		ORDER BY 2 DESC, 1;
+	`)
+	if err != nil {
+		fmt.Fprintf(stdout, "{⚠️  } Failed to read table sizes: %v\n", err)
+		exit(1)
+	}
+	defer rows.Close()
+
+	fmt.Fprintf(output, "{💾 } Database %s: %s\n\n", dbName, dbSize)
+
+	var total int64
+	count := 0
+	for rows.Next() {
+		var name, pretty string
+		var bytes int64
+		if err := rows.Scan(&name, &bytes, &pretty); err != nil {
+			fmt.Fprintf(stdout, "{⚠️  } Failed to read table size: %v\n", err)
+			continue
+		}
+		count++
+		total += bytes
+		fmt.Fprintf(output, "    %-40s %10s\n", name, pretty)
+	}
+
+	if count == 0 {
+		fmt.Fprintln(stdout, "{⚠️  } No tables found")
+		exitIfEmpty()
+		return
+	}
+	fmt.Fprintf(output, "    %-40s %10s\n", "total (public tables)", formatBytes(total))
+}
+
+// formatBytes renders a byte count with binary units, like pg_size_pretty.
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d bytes", n)
+	}
+	div, exp := int64(unit), 0
+	for v := n / unit; v >= unit && exp < 4; v /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(n)/float64(div), "KMGTP"[exp])
+}
+
+// --- Single-table description ---
+
+// runDescribe prints one table's columns, keys and indexes as a single
+// block, in the spirit of psql's \d. It exposes structure only, so it needs
+// no core access.
+func runDescribe(db *sql.DB, args []string) {
+	if len(args) != 1 {
+		fmt.Fprintln(stdout, "(!) Usage: hvmd describe <table>")
+		exit(1)
+	}
+	table := args[0]
+
+	tables, err := listTables(db, func(string) bool { return true })
+	if err != nil {
+		fmt.Fprintf(stdout, "(X) Failed to fetch tables: %s\n", describeQueryErr(err))
+		exit(1)
+	}
+	if !slices.Contains(tables, table) {
+		fmt.Fprintf(stdout, "(!) No such table: %s\n", table)
+		exit(1)
+	}
+
+	ctx, cancel := queryContext()
+	defer cancel()
+
+	pkCols, err := primaryKeyColumns(ctx, db, table)
+	if err != nil {
+		fmt.Fprintf(stdout, "(X) Failed to read primary key: %s\n", describeQueryErr(err))
+		exit(1)
+	}
+
+	rows, err := db.QueryContext(ctx, `
+		SELECT column_name, data_type, is_nullable, coalesce(column_default, '')
+		FROM information_schema.columns
+		WHERE table_schema = 'public' AND table_name = $1
+		ORDER BY ordinal_position;
+	`, table)
+	if err != nil {
+		fmt.Fprintf(stdout, "(X) Failed to read columns: %s\n", describeQueryErr(err))
+		exit(1)
+	}
+	defer rows.Close()
+
+	var data [][]string
+	var pk []string
+	for rows.Next() {
+		var name, dataType, nullable, def string
+		if err := rows.Scan(&name, &dataType, &nullable, &def); err != nil {
+			fmt.Fprintf(stdout, "(X) Failed to read column: %v\n", err)
+			exit(1)
+		}
+		notNull := ""
+		if nullable == "NO" {
+			notNull = "not null"
+		}
+		if pkCols[name] {
+			pk = append(pk, name)
+		}
+		data = append(data, []string{name, dataType, notNull, def})
+	}
+	if err := rows.Err(); err != nil {
+		fmt.Fprintf(stdout, "(X) Failed to read columns: %s\n", describeQueryErr(err))
+		exit(1)
+	}
+
+	idxs, err := tableIndexes(ctx, db, table)
+	if err != nil {
+		fmt.Fprintf(stdout, "(X) Failed to read indexes: %s\n", describeQueryErr(err))
+		exit(1)
+	}
+	fks, err := foreignKeys(ctx, db, table)
+	if err != nil {
+		fmt.Fprintf(stdout, "(X) Failed to read foreign keys: %s\n", describeQueryErr(err))
+		exit(1)
+	}
+
+	fmt.Fprintf(output, "Table \"public.%s\"\n", table)
+	renderTable([]string{"Column", "Type", "Nullable", "Default"}, data)
+
+	if len(pk) > 0 {
+		fmt.Fprintf(output, "Primary key: (%s)\n", strings.Join(pk, ", "))
+	}
+	if len(idxs) > 0 {
+		fmt.Fprintln(output, "Indexes:")
+		for _, idx := range idxs {
+			kind := ""
+			if idx.unique {
+				kind = " UNIQUE"
+			}
+			fmt.Fprintf(output, "    %q%s %s\n", idx.name, kind, idx.def)
+		}
+	}
+	if len(fks) > 0 {
+		fmt.Fprintln(output, "Foreign keys:")
+		for _, fk := range fks {
+			fmt.Fprintf(output, "    %q (%s) -> %s(%s)\n", fk.name, fk.column, fk.refTable, fk.refColumn)
+		}
+	}
+}
+
+// --- Sequences ---
+
+// showSequences lists public sequences with their current value. A sequence
+// nextval has never touched reports its start value, so it is shown apart.
+func showSequences(db *sql.DB) {
+	rows, err := db.Query(`
+		SELECT s.sequence_name, ps.last_value, ps.start_value, ps.min_value, ps.max_value, ps.increment_by
+		FROM information_schema.sequences s
+		JOIN pg_sequences ps
+			ON ps.schemaname = s.sequence_schema AND ps.sequencename = s.sequence_name
+		WHERE s.sequence_schema = 'public'
+		ORDER BY s.sequence_name;
+	`)
+	if err != nil {
+		fmt.Fprintf(stdout, "{⚠️  } Failed to read sequences: %v\n", err)
+		exit(1)
+	}
+	defer rows.Close()
+
+	var data [][]string
+	for rows.Next() {
+		var name string
+		var last sql.NullInt64
+		var start, minValue, maxValue, increment int64
+		if err := rows.Scan(&name, &last, &start, &minValue, &maxValue, &increment); err != nil {
+			fmt.Fprintf(stdout, "{⚠️  } Failed to read sequence: %v\n", err)
+			continue
+		}
+
+		// pg_sequences.last_value is NULL until nextval is first called.
+		current, used := "never called", "0%"
+		if last.Valid {
+			current = strconv.FormatInt(last.Int64, 10)
+			// Headroom runs towards max_value, or min_value when descending.
+			span, done := float64(maxValue-start), float64(last.Int64-start)
+			if increment < 0 {
+				span, done = float64(start-minValue), float64(start-last.Int64)
+			}
+			used = "-"
+			if span > 0 {
+				used = fmt.Sprintf("%.1f%%", done/span*100)
+			}
+		}
+		limit := maxValue
+		if increment < 0 {
+			limit = minValue
+		}
+		data = append(data, []string{name, current, strconv.FormatInt(start, 10), strconv.FormatInt(limit, 10), used})
+	}
+
+	if len(data) == 0 {
+		fmt.Fprintln(stdout, "{⚠️  } No sequences found")
+		exitIfEmpty()
+		return
+	}
+	renderTable([]string{"sequence", "last_value", "start", "limit", "used"}, data)
+}
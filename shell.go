@@ -0,0 +1,108 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+// --- Interactive shell ---
+
+// runShell reads commands from stdin over the already-open connection until
+// `exit`, `quit` or EOF. The session keeps the core mode it was started with.
+func runShell(db *sql.DB, user string) {
+	if inBatch {
+		fmt.Fprintln(stdout, "(!) shell cannot be started from a batch or another shell")
+		exit(1)
+	}
+
+	prompt := "hvmd> "
+	if coreEnabled {
+		prompt = "hvmd[core]> "
+	}
+	readLine := shellReader(prompt)
+
+	infof("{🐚 } Connected as %s. Type 'help' for commands, 'exit' to leave.", user)
+
+	inBatch = true
+	defer func() { inBatch = false }()
+
+	for {
+		line, err := readLine()
+		if err != nil {
+			if err != io.EOF {
+				fmt.Fprintf(stdout, "(X) Failed to read input: %v\n", err)
+			}
+			return
+		}
+
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if line == "exit" || line == "quit" {
+			return
+		}
+
+		if code := runShellLine(line, db, user); code != 0 {
+			fmt.Fprintf(stdout, "(X) Exit code %d\n", code)
+		}
+	}
+}
+
+// runShellLine executes one shell line. --core is accepted in a core session
+// for muscle memory, and rejected otherwise.
+func runShellLine(line string, db *sql.DB, user string) int {
+	fields, err := splitCommandLine(line)
+	if err != nil {
+		fmt.Fprintf(stdout, "(!) %v\n", err)
+		return 1
+	}
+
+	fields, lineCore := popFlag(fields, "--core")
+	if lineCore && !coreEnabled {
+		fmt.Fprintln(stdout, "(!) Unknown command: --core")
+		return 1
+	}
+	if len(fields) == 0 {
+		return 0
+	}
+
+	return runStep(func() { dispatch(fields[0], fields[1:], db, user) })
+}
+
+// shellReader returns a line reader for the shell. On a terminal it offers
+// line editing and arrow-key history; otherwise it reads stdin plainly so
+// commands can be piped in.
+func shellReader(prompt string) func() (string, error) {
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return func() (string, error) {
+			line, err := stdinReader.ReadString('\n')
+			if err == io.EOF && line != "" {
+				return line, nil
+			}
+			return line, err
+		}
+	}
+
+	t := term.NewTerminal(struct {
+		io.Reader
+		io.Writer
+	}{os.Stdin, os.Stdout}, prompt)
+
+	return func() (string, error) {
+		// Raw mode only while editing the line, so command output keeps
+		// normal newline handling.
+		state, err := term.MakeRaw(fd)
+		if err != nil {
+			return "", err
+		}
+		defer term.Restore(fd, state)
+		return t.ReadLine()
+	}
+}
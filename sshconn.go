@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// --- SSH client ---
+
+// sshSetting reads name from the environment first, then from the .key file.
+func sshSetting(keyEnv map[string]string, name string) string {
+	if v := os.Getenv(name); v != "" {
+		return v
+	}
+	return keyEnv[name]
+}
+
+// checkPublicKey reports whether key parses as an authorized_keys line.
+func checkPublicKey(key string) error {
+	_, _, _, _, err := ssh.ParseAuthorizedKey([]byte(key))
+	return err
+}
+
+// sshSigner builds a signer from SSH_IDENTITY_FILE when set, otherwise from
+// SSH_KEY itself. Encrypted private keys prompt for their passphrase.
+func sshSigner(keyEnv map[string]string) (ssh.Signer, error) {
+	pemBytes := []byte(keyEnv["SSH_KEY"])
+	if path := sshSetting(keyEnv, "SSH_IDENTITY_FILE"); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("read identity file: %w", err)
+		}
+		pemBytes = data
+	}
+
+	signer, err := ssh.ParsePrivateKey(pemBytes)
+	var missing *ssh.PassphraseMissingError
+	if errors.As(err, &missing) {
+		passphrase, perr := readPassphrase("Passphrase for SSH private key: ")
+		if perr != nil {
+			return nil, perr
+		}
+		return ssh.ParsePrivateKeyWithPassphrase(pemBytes, passphrase)
+	}
+	if err != nil {
+		if _, _, _, _, pubErr := ssh.ParseAuthorizedKey(pemBytes); pubErr == nil {
+			return nil, errors.New("SSH_KEY holds a public key; set SSH_IDENTITY_FILE to the matching private key")
+		}
+		return nil, fmt.Errorf("parse private key: %w", err)
+	}
+	return signer, nil
+}
+
+// dialSSH connects to addr (host:port) as user, verifying the host key
+// against ~/.ssh/known_hosts.
+func dialSSH(keyEnv map[string]string, user, addr string) (*ssh.Client, error) {
+	signer, err := sshSigner(keyEnv)
+	if err != nil {
+		return nil, err
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return nil, err
+	}
+	hostKeys, err := knownhosts.New(filepath.Join(home, ".ssh", "known_hosts"))
+	if err != nil {
+		return nil, fmt.Errorf("load known_hosts: %w", err)
+	}
+
+	return ssh.Dial("tcp", addr, &ssh.ClientConfig{
+		User:            user,
+		Auth:            []ssh.AuthMethod{ssh.PublicKeys(signer)},
+		HostKeyCallback: hostKeys,
+		Timeout:         10 * time.Second,
+	})
+}
+
+// sshTarget resolves SSH_USER, SSH_HOST and SSH_PORT (default 22).
+func sshTarget(keyEnv map[string]string) (user, addr string, err error) {
+	user = sshSetting(keyEnv, "SSH_USER")
+	host := sshSetting(keyEnv, "SSH_HOST")
+	port := sshSetting(keyEnv, "SSH_PORT")
+	if port == "" {
+		port = "22"
+	}
+	if user == "" || host == "" {
+		return "", "", errors.New("SSH_USER and SSH_HOST must be set in the environment or .key")
+	}
+	return user, net.JoinHostPort(host, port), nil
+}
+
+// --- SSH tunnel ---
+
+// sshDialer makes lib/pq open its connections through an SSH client, so the
+// database host and port are resolved on the bastion's side.
+type sshDialer struct {
+	client *ssh.Client
+}
+
+func (d sshDialer) Dial(network, addr string) (net.Conn, error) {
+	return d.client.Dial(network, addr)
+}
+
+func (d sshDialer) DialTimeout(network, addr string, timeout time.Duration) (net.Conn, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return d.client.DialContext(ctx, network, addr)
+}
+
+func (d sshDialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	return d.client.DialContext(ctx, network, addr)
+}
+
+// openTunnel connects to the bastion named by spec (user@host[:port], port
+// 22 by default) with the key from the key file.
+func openTunnel(spec string) (*ssh.Client, error) {
+	user, hostport, ok := strings.Cut(spec, "@")
+	if !ok || user == "" || hostport == "" {
+		return nil, errors.New("expected user@host[:port]")
+	}
+	addr := hostport
+	if _, _, err := net.SplitHostPort(hostport); err != nil {
+		addr = net.JoinHostPort(strings.Trim(hostport, "[]"), "22")
+	}
+
+	keyEnv, err := readKeyFile(keyFilePath())
+	if err != nil {
+		return nil, err
+	}
+	return dialSSH(keyEnv, user, addr)
+}
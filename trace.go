@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// --- SQL tracing (--trace) ---
+
+// traceSQL logs every statement to stderr with how long the server took to
+// answer. It hooks in below database/sql, so each call site is covered
+// without being touched.
+var traceSQL bool
+
+// pqConn is the part of lib/pq's connection that tracing wraps.
+type pqConn interface {
+	driver.Conn
+	driver.ConnBeginTx
+	driver.ConnPrepareContext
+	driver.QueryerContext
+	driver.ExecerContext
+	driver.Pinger
+}
+
+// traceConnector hands out connections that log what they run.
+type traceConnector struct {
+	driver.Connector
+}
+
+func (c traceConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := c.Connector.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if pc, ok := conn.(pqConn); ok {
+		return traceConn{pc}, nil
+	}
+	return conn, nil
+}
+
+type traceConn struct {
+	pqConn
+}
+
+func (c traceConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	start := time.Now()
+	rows, err := c.pqConn.QueryContext(ctx, query, args)
+	traceStatement(query, time.Since(start), err)
+	return rows, err
+}
+
+func (c traceConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	start := time.Now()
+	res, err := c.pqConn.ExecContext(ctx, query, args)
+	traceStatement(query, time.Since(start), err)
+	return res, err
+}
+
+// IsValid and ResetSession pass through lib/pq's checks, so database/sql
+// still drops a broken connection instead of reusing it.
+func (c traceConn) IsValid() bool {
+	if v, ok := c.pqConn.(driver.Validator); ok {
+		return v.IsValid()
+	}
+	return true
+}
+
+func (c traceConn) ResetSession(ctx context.Context) error {
+	if r, ok := c.pqConn.(driver.SessionResetter); ok {
+		return r.ResetSession(ctx)
+	}
+	return nil
+}
+
+// traceStatement prints one statement on a single line. Rows are still
+// streaming when a query returns, so its time is the time to first result.
+func traceStatement(query string, took time.Duration, err error) {
+	line := fmt.Sprintf("[trace] %8s  %s", took.Round(time.Microsecond), strings.Join(strings.Fields(query), " "))
+	if err != nil {
+		line += "  -- error: " + err.Error()
+	}
+	fmt.Fprintln(stderr, line)
+}
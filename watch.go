@@ -0,0 +1,41 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// --- Live refresh ---
+
+// runWatch clears the screen and reruns step every interval over the open
+// connection until Ctrl-C. A failing run is reported and retried on the next
+// tick rather than ending the watch.
+func runWatch(interval time.Duration, title []string, step func()) {
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(sigs)
+
+	inBatch = true
+	defer func() { inBatch = false }()
+
+	for {
+		fmt.Fprint(stdout, "\x1b[H\x1b[2J")
+		infof("Every %s: hvmd %s    %s", interval, strings.Join(title, " "), time.Now().Format("15:04:05"))
+		infof("")
+
+		if code := runStep(step); code != 0 {
+			fmt.Fprintf(stdout, "(X) Exit code %d\n", code)
+		}
+
+		select {
+		case <-sigs:
+			fmt.Fprintln(stdout, "")
+			return
+		case <-time.After(interval):
+		}
+	}
+}